@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/chelobotix/booking-go/internal/handlers"
+	"github.com/chelobotix/booking-go/internal/importer"
+	"os"
+)
+
+// runImport implements the import subcommand:
+//
+//	web import [-commit] file.csv
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	commit := flags.Bool("commit", false, "insert the rows when the whole file is valid")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return errors.New("usage: web import [-commit] file.csv")
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	report, err := importer.Run(handlers.Repo.DB, file, *commit)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range report.Rows {
+		for _, msg := range row.Messages() {
+			fmt.Printf("line %d: %s\n", row.Line, msg)
+		}
+	}
+
+	fmt.Printf("%d rows checked, %d with errors\n", len(report.Rows), report.ErrorCount())
+
+	switch {
+	case report.Committed:
+		fmt.Println("import committed")
+	case !report.Valid():
+		return errors.New("import has errors, nothing was written")
+	default:
+		fmt.Println("dry run only, use -commit to write the rows")
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/chelobotix/booking-go/internal/dates"
+	"github.com/chelobotix/booking-go/internal/handlers"
+	"time"
+)
+
+// startPurgeJob permanently removes reservations that have been in the trash
+// longer than the retention period, once at startup and then daily
+func startPurgeJob() {
+	go func() {
+		ticker := time.NewTicker(24 * time.Hour)
+		defer ticker.Stop()
+
+		for {
+			purged, err := handlers.Repo.DB.PurgeDeletedReservations(time.Now().Add(-appConfig.TrashRetention))
+			if err != nil {
+				errorLog.Println(err)
+			} else if purged > 0 {
+				infoLog.Printf("purged %d deleted reservations", purged)
+			}
+
+			<-ticker.C
+		}
+	}()
+}
+
+// startHoldSweeper releases rooms held for guests who never finished checking out and
+// expired waitlist offers, then offers whatever that freed up to the waitlist
+func startHoldSweeper() {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			expired, err := handlers.Repo.DB.ExpireWaitlistEntries(dates.Today(appConfig.TimeZone))
+			if err != nil {
+				errorLog.Println(err)
+			} else if expired > 0 {
+				infoLog.Printf("expired %d waitlist entries", expired)
+			}
+
+			released, err := handlers.Repo.DB.DeleteExpiredHolds()
+			if err != nil {
+				errorLog.Println(err)
+			} else if released > 0 {
+				infoLog.Printf("released %d expired holds", released)
+			}
+
+			handlers.Repo.ProcessWaitlist()
+		}
+	}()
+}
+
+// startImportSweeper removes import files that were checked but never committed, hourly
+func startImportSweeper() {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			removed, err := handlers.RemoveStaleImports()
+			if err != nil {
+				errorLog.Println(err)
+			} else if removed > 0 {
+				infoLog.Printf("removed %d abandoned import files", removed)
+			}
+
+			<-ticker.C
+		}
+	}()
+}
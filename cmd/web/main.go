@@ -5,15 +5,19 @@ import (
 	"fmt"
 	"github.com/alexedwards/scs/v2"
 	"github.com/chelobotix/booking-go/internal/config"
+	"github.com/chelobotix/booking-go/internal/currency"
 	"github.com/chelobotix/booking-go/internal/driver"
 	"github.com/chelobotix/booking-go/internal/handlers"
 	"github.com/chelobotix/booking-go/internal/helpers"
+	"github.com/chelobotix/booking-go/internal/i18n"
 	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/chelobotix/booking-go/internal/payments"
 	"github.com/chelobotix/booking-go/internal/render"
 	"log"
 	"net/http"
 	"os"
 	"time"
+	_ "time/tzdata"
 )
 
 const portNumber = ":8080"
@@ -33,8 +37,18 @@ func main() {
 
 	defer db.SQL.Close()
 
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := runImport(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	defer close(appConfig.MailChan)
 	listenForMail()
+	startPurgeJob()
+	startHoldSweeper()
+	startImportSweeper()
 
 	fmt.Println(fmt.Sprintf("Staring application on port %s", portNumber))
 
@@ -52,11 +66,30 @@ func run() (*driver.DB, error) {
 	gob.Register(models.Room{})
 	gob.Register(models.Restriction{})
 	gob.Register(map[string]int{})
+	gob.Register([]models.Reservation{})
+	gob.Register(models.Booking{})
+	gob.Register(i18n.Message{})
 
 	mailChan := make(chan models.MailData)
 	appConfig.MailChan = mailChan
 
 	appConfig.Production = false
+	appConfig.TrashRetention = 30 * 24 * time.Hour
+	appConfig.HoldDuration = 15 * time.Minute
+	appConfig.WaitlistOfferDuration = 24 * time.Hour
+	appConfig.SiteURL = "http://localhost" + portNumber
+	appConfig.PaymentGateway = payments.NewFakeGateway()
+	appConfig.DepositPercent = 30
+	appConfig.PropertyName = "Fort Smythe Bed and Breakfast"
+	appConfig.TaxPercent = 10
+	appConfig.Currencies = currency.NewTable("USD")
+
+	timeZone, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		return nil, err
+	}
+	appConfig.TimeZone = timeZone
+
 	infoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
 	appConfig.InfoLog = infoLog
 	errorLog = log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
@@ -76,7 +109,15 @@ func run() (*driver.DB, error) {
 	}
 	log.Println("Connected to database")
 
-	tc, err := render.CreateTemplateCache()
+	translations, err := i18n.Load("./locales")
+	if err != nil {
+		log.Fatal("cant load translations")
+		return nil, err
+	}
+
+	appConfig.Translations = translations
+
+	tc, err := render.CreateTemplateCache(translations)
 
 	if err != nil {
 		log.Fatal("cant create templateCache")
@@ -89,6 +130,14 @@ func run() (*driver.DB, error) {
 	repo := handlers.NewRepo(&appConfig, db)
 	handlers.NewHandlers(repo)
 
+	currencies, err := repo.DB.AllCurrencies()
+	if err != nil {
+		log.Fatal("cant load currencies")
+		return nil, err
+	}
+
+	appConfig.Currencies.Load(currencies)
+
 	render.NewRenderer(&appConfig)
 
 	helpers.NewHelpers(&appConfig)
@@ -2,8 +2,11 @@ package main
 
 import (
 	"github.com/chelobotix/booking-go/internal/helpers"
+	"github.com/chelobotix/booking-go/internal/i18n"
 	"github.com/justinas/nosurf"
 	"net/http"
+	"strings"
+	"time"
 )
 
 func NoSurf(next http.Handler) http.Handler {
@@ -34,3 +37,52 @@ func Auth(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// GuestAuth lets only logged in guests through
+func GuestAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !helpers.IsGuest(r) {
+			session.Put(r.Context(), "error", "Log in to see your bookings")
+			http.Redirect(w, r, "/account/login", http.StatusSeeOther)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Locale picks the language of the request from a URL prefix such as /es/search-availability,
+// then the lang cookie, then the Accept-Language header. The prefix is stripped before routing
+// and remembered in the cookie so the links on the page keep the language
+func Locale(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		translations := appConfig.Translations
+
+		prefix, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		cookie, cookieErr := r.Cookie("lang")
+
+		var locale string
+		switch {
+		case prefix != "" && translations.Supported(prefix):
+			locale = prefix
+			r.URL.Path = "/" + rest
+			r.URL.RawPath = ""
+
+			http.SetCookie(w, &http.Cookie{
+				Name:     "lang",
+				Value:    locale,
+				Path:     "/",
+				Expires:  time.Now().AddDate(1, 0, 0),
+				HttpOnly: true,
+				Secure:   appConfig.Production,
+				SameSite: http.SameSiteLaxMode,
+			})
+		case cookieErr == nil && translations.Supported(cookie.Value):
+			locale = cookie.Value
+		default:
+			locale = translations.Negotiate(r.Header.Get("Accept-Language"))
+		}
+
+		next.ServeHTTP(w, r.WithContext(i18n.WithLocale(r.Context(), locale)))
+	})
+}
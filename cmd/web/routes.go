@@ -14,6 +14,7 @@ func routes(app *config.AppConfig) http.Handler {
 	mux.Use(middleware.Recoverer)
 	mux.Use(NoSurf)
 	mux.Use(SessionLoad)
+	mux.Use(Locale)
 
 	mux.Get("/", handlers.Repo.Home)
 	mux.Get("/about", handlers.Repo.About)
@@ -23,18 +24,45 @@ func routes(app *config.AppConfig) http.Handler {
 	mux.Get("/search-availability", handlers.Repo.Availability)
 	mux.Post("/search-availability", handlers.Repo.PostAvailability)
 	mux.Post("/search-availability-json", handlers.Repo.AvailabilityJSON)
+	mux.Get("/room-availability/{id}", handlers.Repo.RoomAvailabilityJSON)
 	mux.Get("/choose-room/{id}", handlers.Repo.ChooseRoom)
 	mux.Get("/book-room", handlers.Repo.BookRoom)
+	mux.Get("/add-room/{id}", handlers.Repo.AddRoomToGroup)
+	mux.Get("/remove-room/{index}", handlers.Repo.RemoveRoomFromGroup)
+	mux.Get("/book-combination", handlers.Repo.BookCombination)
 
 	mux.Get("/make-reservation", handlers.Repo.Reservations)
 	mux.Post("/make-reservation", handlers.Repo.PostReservations)
 	mux.Get("/reservation-summary", handlers.Repo.ReservationSummary)
+	mux.Get("/make-group-reservation", handlers.Repo.GroupReservation)
+	mux.Post("/make-group-reservation", handlers.Repo.PostGroupReservation)
+	mux.Get("/group-reservation-summary", handlers.Repo.GroupReservationSummary)
+	mux.Get("/waitlist", handlers.Repo.Waitlist)
+	mux.Post("/waitlist", handlers.Repo.PostWaitlist)
+	mux.Get("/waitlist/{token}", handlers.Repo.WaitlistOffer)
 
 	mux.Get("/user/login", handlers.Repo.UserLogin)
 	mux.Post("/user/login", handlers.Repo.PostUserLogin)
 	mux.Get("/user/logout", handlers.Repo.UserLogout)
 
+	mux.Get("/account/register", handlers.Repo.GuestRegister)
+	mux.Post("/account/register", handlers.Repo.PostGuestRegister)
+	mux.Get("/account/verify/{token}", handlers.Repo.GuestVerifyEmail)
+	mux.Get("/account/login", handlers.Repo.GuestLogin)
+	mux.Post("/account/login", handlers.Repo.PostGuestLogin)
+	mux.Get("/account/logout", handlers.Repo.GuestLogout)
+
+	mux.Route("/account/bookings", func(mux chi.Router) {
+		mux.Use(GuestAuth)
+
+		mux.Get("/", handlers.Repo.MyBookings)
+		mux.Get("/{id}", handlers.Repo.MyBooking)
+		mux.Post("/{id}", handlers.Repo.PostMyBooking)
+		mux.Post("/{id}/cancel", handlers.Repo.PostCancelMyBooking)
+	})
+
 	mux.Get("/contact", handlers.Repo.Contact)
+	mux.Post("/currency", handlers.Repo.PostCurrency)
 
 	fileServer := http.FileServer(http.Dir("./static"))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
@@ -48,11 +76,44 @@ func routes(app *config.AppConfig) http.Handler {
 		mux.Get("/reservations-new", handlers.Repo.AdminNewReservations)
 		mux.Get("/reservations-all", handlers.Repo.AdminAllReservations)
 		mux.Get("/reservations-calendar", handlers.Repo.AdminCalendarReservations)
+		mux.Get("/reservations-export", handlers.Repo.AdminExportReservations)
+		mux.Get("/import", handlers.Repo.AdminImport)
+		mux.Post("/import", handlers.Repo.AdminPostImport)
+		mux.Get("/audit", handlers.Repo.AdminAuditLog)
+		mux.Get("/waitlist", handlers.Repo.AdminWaitlist)
+		mux.Get("/promo-codes", handlers.Repo.AdminPromoCodes)
+		mux.Post("/promo-codes", handlers.Repo.AdminPostPromoCode)
+		mux.Get("/toggle-promo-code/{id}", handlers.Repo.AdminTogglePromoCode)
+		mux.Get("/cancellation-policies", handlers.Repo.AdminCancellationPolicies)
+		mux.Post("/cancellation-policies", handlers.Repo.AdminPostCancellationPolicy)
+		mux.Get("/toggle-cancellation-policy/{id}", handlers.Repo.AdminToggleCancellationPolicy)
+		mux.Get("/housekeeping", handlers.Repo.AdminHousekeeping)
+		mux.Post("/housekeeping/{id}", handlers.Repo.AdminPostRoomStatus)
+		mux.Get("/front-desk", handlers.Repo.AdminFrontDesk)
+		mux.Get("/front-desk/{id}", handlers.Repo.AdminFrontDeskStay)
+		mux.Post("/front-desk/{id}/check-in", handlers.Repo.AdminPostCheckIn)
+		mux.Post("/front-desk/{id}/extend", handlers.Repo.AdminPostExtendStay)
+		mux.Post("/front-desk/{id}/check-out", handlers.Repo.AdminPostCheckOut)
+		mux.Get("/rooms", handlers.Repo.AdminRooms)
+		mux.Post("/rooms/{id}", handlers.Repo.AdminPostRoom)
+		mux.Get("/currencies", handlers.Repo.AdminCurrencies)
+		mux.Post("/currencies", handlers.Repo.AdminPostCurrency)
+		mux.Post("/currencies/{id}", handlers.Repo.AdminPostUpdateCurrency)
+		mux.Get("/toggle-currency/{id}", handlers.Repo.AdminToggleCurrency)
+		mux.Get("/booking-rules", handlers.Repo.AdminBookingRules)
+		mux.Post("/booking-rules", handlers.Repo.AdminPostBookingRule)
+		mux.Get("/delete-booking-rule/{id}", handlers.Repo.AdminDeleteBookingRule)
 		mux.Get("/process-reservation/{src}/{id}", handlers.Repo.AdminProcessReservation)
-		mux.Get("/delete-reservation/{src}/{id}", handlers.Repo.AdminDeleteReservation)
+		mux.Post("/delete-reservation/{src}/{id}", handlers.Repo.AdminDeleteReservation)
+		mux.Get("/reservations-trash", handlers.Repo.AdminTrashReservations)
+		mux.Get("/restore-reservation/{id}", handlers.Repo.AdminRestoreReservation)
 
 		mux.Get("/reservations/{src}/{id}", handlers.Repo.AdminShowReservation)
 		mux.Post("/reservations/{src}/{id}", handlers.Repo.AdminPostShowReservation)
+		mux.Get("/invoice/{id}", handlers.Repo.AdminReservationInvoice)
+		mux.Get("/guests", handlers.Repo.AdminGuests)
+		mux.Get("/guests/{id}", handlers.Repo.AdminShowGuest)
+		mux.Post("/guests/{id}", handlers.Repo.AdminPostGuest)
 	})
 
 	return mux
@@ -3,23 +3,26 @@ module github.com/chelobotix/booking-go
 go 1.23.2
 
 require (
-	github.com/alexedwards/scs/v2 v2.8.0 // indirect
-	github.com/asaskevich/govalidator v0.0.0-20230301143203-a9d515a09cc2 // indirect
-	github.com/go-chi/chi/v5 v5.1.0 // indirect
+	github.com/alexedwards/scs/v2 v2.8.0
+	github.com/asaskevich/govalidator v0.0.0-20230301143203-a9d515a09cc2
+	github.com/go-chi/chi/v5 v5.1.0
+	github.com/jackc/pgconn v1.14.3
+	github.com/jackc/pgx/v5 v5.7.1
+	github.com/justinas/nosurf v1.1.1
+	github.com/xhit/go-simple-mail/v2 v2.16.0
+	golang.org/x/crypto v0.28.0
+)
+
+require (
 	github.com/jackc/chunkreader/v2 v2.0.1 // indirect
-	github.com/jackc/pgconn v1.14.3 // indirect
 	github.com/jackc/pgio v1.0.0 // indirect
 	github.com/jackc/pgpassfile v1.0.0 // indirect
 	github.com/jackc/pgproto3/v2 v2.3.3 // indirect
 	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
 	github.com/jackc/pgx v3.6.2+incompatible // indirect
-	github.com/jackc/pgx/v5 v5.7.1 // indirect
 	github.com/jackc/puddle/v2 v2.2.2 // indirect
-	github.com/justinas/nosurf v1.1.1 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/toorop/go-dkim v0.0.0-20201103131630-e1cd1a0a5208 // indirect
-	github.com/xhit/go-simple-mail/v2 v2.16.0 // indirect
-	golang.org/x/crypto v0.28.0 // indirect
 	golang.org/x/sync v0.8.0 // indirect
 	golang.org/x/text v0.19.0 // indirect
 )
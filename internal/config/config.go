@@ -2,18 +2,45 @@ package config
 
 import (
 	"github.com/alexedwards/scs/v2"
+	"github.com/chelobotix/booking-go/internal/currency"
+	"github.com/chelobotix/booking-go/internal/i18n"
 	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/chelobotix/booking-go/internal/payments"
 	"html/template"
 	"log"
+	"time"
 )
 
 // AppConfig hold the application config
 type AppConfig struct {
-	UseCache      bool
-	TemplateCache map[string]*template.Template
+	UseCache bool
+	// TemplateCache holds the parsed pages of every language, by language and then page name
+	TemplateCache map[string]map[string]*template.Template
 	Production    bool
 	Session       *scs.SessionManager
 	InfoLog       *log.Logger
 	ErrorLog      *log.Logger
 	MailChan      chan models.MailData
+	// TrashRetention is how long deleted reservations are kept before being purged
+	TrashRetention time.Duration
+	// HoldDuration is how long a chosen room is held for a guest while they fill out the form
+	HoldDuration time.Duration
+	// WaitlistOfferDuration is how long a waitlisted guest has to book once dates free up
+	WaitlistOfferDuration time.Duration
+	// SiteURL is the public address used for links in emails
+	SiteURL string
+	// PaymentGateway charges and refunds guests' cards
+	PaymentGateway payments.Gateway
+	// DepositPercent is the part of the total charged when booking
+	DepositPercent int
+	// PropertyName is who invoices are issued by
+	PropertyName string
+	// TaxPercent is the tax included in room prices, shown on invoices
+	TaxPercent int
+	// Translations are the message catalogs the public site is translated with
+	Translations *i18n.Bundle
+	// Currencies are the currencies prices are shown and charged in. Prices are stored in its base currency
+	Currencies *currency.Table
+	// TimeZone is where the property is. Today, arrival days and times shown to staff and guests are its
+	TimeZone *time.Location
 }
@@ -0,0 +1,139 @@
+package currency
+
+import (
+	"fmt"
+	"github.com/chelobotix/booking-go/internal/models"
+	"math"
+	"strings"
+	"sync"
+)
+
+// Convert returns an amount in cents of the base currency in the smallest unit of c, rounded
+// half up by c's rules
+func Convert(cents int, c models.Currency) int {
+	rate := c.Rate
+	if rate <= 0 {
+		rate = 1
+	}
+
+	amount := math.Round(float64(cents) / 100 * rate * math.Pow10(c.Decimals))
+
+	if c.RoundTo > 1 {
+		amount = math.Round(amount/float64(c.RoundTo)) * float64(c.RoundTo)
+	}
+
+	return int(amount)
+}
+
+// Format shows an amount in the smallest unit of c with c's symbol, or its code when it has none
+func Format(amount int, c models.Currency) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	symbol := c.Symbol
+	if symbol == "" {
+		symbol = c.Code + " "
+	}
+
+	if c.Decimals <= 0 {
+		return fmt.Sprintf("%s%s%d", sign, symbol, amount)
+	}
+
+	unit := int(math.Pow10(c.Decimals))
+	return fmt.Sprintf("%s%s%d.%0*d", sign, symbol, amount/unit, c.Decimals, amount%unit)
+}
+
+// Price converts an amount in cents of the base currency to c and formats it
+func Price(cents int, c models.Currency) string {
+	return Format(Convert(cents, c), c)
+}
+
+// Table is the currencies prices can be shown in, kept in memory so pages don't read them every
+// time. It is loaded at start and again whenever staff change a currency
+type Table struct {
+	mu         sync.RWMutex
+	base       string
+	currencies []models.Currency
+}
+
+// NewTable returns an empty table for the base currency prices are stored in
+func NewTable(base string) *Table {
+	return &Table{base: strings.ToUpper(base)}
+}
+
+// Load replaces the currencies in the table
+func (t *Table) Load(currencies []models.Currency) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.currencies = currencies
+}
+
+// Base returns the currency prices are stored in. Its rate is always 1
+func (t *Table) Base() models.Currency {
+	base := models.Currency{Rate: 1, Decimals: 2, RoundTo: 1, Active: true}
+	if t == nil {
+		return base
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	base.Code = t.base
+	for _, c := range t.currencies {
+		if c.Code == t.base {
+			base = c
+			base.Rate = 1
+		}
+	}
+
+	return base
+}
+
+// IsBase reports whether code is the base currency
+func (t *Table) IsBase(code string) bool {
+	return t != nil && code == t.base
+}
+
+// Get returns the active currency with code
+func (t *Table) Get(code string) (models.Currency, bool) {
+	if t == nil {
+		return models.Currency{}, false
+	}
+	if code == t.base {
+		return t.Base(), true
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	for _, c := range t.currencies {
+		if c.Code == code && c.Active {
+			return c, true
+		}
+	}
+
+	return models.Currency{}, false
+}
+
+// Active returns the currencies guests can choose from, the base currency first
+func (t *Table) Active() []models.Currency {
+	currencies := []models.Currency{t.Base()}
+	if t == nil {
+		return currencies
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	for _, c := range t.currencies {
+		if c.Active && c.Code != t.base {
+			currencies = append(currencies, c)
+		}
+	}
+
+	return currencies
+}
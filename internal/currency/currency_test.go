@@ -0,0 +1,102 @@
+package currency
+
+import (
+	"github.com/chelobotix/booking-go/internal/models"
+	"testing"
+)
+
+var (
+	usd = models.Currency{Code: "USD", Symbol: "$", Rate: 1, Decimals: 2, RoundTo: 1, Active: true}
+	eur = models.Currency{Code: "EUR", Symbol: "€", Rate: 0.92, Decimals: 2, RoundTo: 1, Active: true}
+	jpy = models.Currency{Code: "JPY", Symbol: "¥", Rate: 151.5, Decimals: 0, RoundTo: 1, Active: true}
+	clp = models.Currency{Code: "CLP", Rate: 950, Decimals: 0, RoundTo: 10, Active: true}
+	kwd = models.Currency{Code: "KWD", Rate: 0.307, Decimals: 3, RoundTo: 1, Active: false}
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name  string
+		cents int
+		c     models.Currency
+		want  int
+	}{
+		{"base", 12345, usd, 12345},
+		{"cents", 10000, eur, 9200},
+		{"rounds half up", 1, models.Currency{Rate: 0.5, Decimals: 2}, 1},
+		{"rounds down", 3, models.Currency{Rate: 0.1, Decimals: 2}, 0},
+		{"no decimals", 10000, jpy, 15150},
+		{"no decimals rounds", 1, jpy, 2},
+		{"three decimals", 10000, kwd, 30700},
+		{"round to tens", 1234, clp, 11720},
+		{"round to tens up", 1235, clp, 11730},
+		{"no rate", 500, models.Currency{Decimals: 2}, 500},
+		{"negative rate", 500, models.Currency{Rate: -2, Decimals: 2}, 500},
+		{"zero", 0, eur, 0},
+		{"refund", -10000, eur, -9200},
+	}
+
+	for _, tt := range tests {
+		if got := Convert(tt.cents, tt.c); got != tt.want {
+			t.Errorf("%s: Convert(%d, %s) = %d, want %d", tt.name, tt.cents, tt.c.Code, got, tt.want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		amount int
+		c      models.Currency
+		want   string
+	}{
+		{12345, usd, "$123.45"},
+		{5, usd, "$0.05"},
+		{-12345, eur, "-€123.45"},
+		{15150, jpy, "¥15150"},
+		{11720, clp, "CLP 11720"},
+		{30700, kwd, "KWD 30.700"},
+	}
+
+	for _, tt := range tests {
+		if got := Format(tt.amount, tt.c); got != tt.want {
+			t.Errorf("Format(%d, %s) = %q, want %q", tt.amount, tt.c.Code, got, tt.want)
+		}
+	}
+}
+
+func TestTable(t *testing.T) {
+	table := NewTable("usd")
+	table.Load([]models.Currency{eur, kwd, jpy})
+
+	if base := table.Base(); base.Code != "USD" || base.Rate != 1 {
+		t.Errorf("Base() = %s at %v, want USD at 1", base.Code, base.Rate)
+	}
+
+	tests := []struct {
+		code   string
+		wantOk bool
+	}{
+		{"USD", true},
+		{"EUR", true},
+		{"KWD", false},
+		{"GBP", false},
+	}
+
+	for _, tt := range tests {
+		if _, ok := table.Get(tt.code); ok != tt.wantOk {
+			t.Errorf("Get(%q) ok = %v, want %v", tt.code, ok, tt.wantOk)
+		}
+	}
+
+	var codes []string
+	for _, c := range table.Active() {
+		codes = append(codes, c.Code)
+	}
+	if len(codes) != 3 || codes[0] != "USD" || codes[1] != "EUR" || codes[2] != "JPY" {
+		t.Errorf("Active() = %v, want [USD EUR JPY]", codes)
+	}
+
+	var none *Table
+	if base := none.Base(); base.Rate != 1 || base.Decimals != 2 {
+		t.Errorf("nil table Base() = %+v, want rate 1 and 2 decimals", base)
+	}
+}
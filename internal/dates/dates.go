@@ -0,0 +1,173 @@
+package dates
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"time"
+)
+
+// Layout is how dates are written in forms, urls and the database
+const Layout = "2006-01-02"
+
+// Date is a day on the calendar with no time of day or time zone, such as an arrival day. Stays
+// are booked in days at the property, so a date reads the same wherever it is shown or stored.
+// The zero Date means no date
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+// New returns the date of year, month and day, normalizing them like time.Date does
+func New(year int, month time.Month, day int) Date {
+	return Of(time.Date(year, month, day, 0, 0, 0, 0, time.UTC))
+}
+
+// Of returns the day t falls on in its own location
+func Of(t time.Time) Date {
+	if t.IsZero() {
+		return Date{}
+	}
+	year, month, day := t.Date()
+	return Date{year, month, day}
+}
+
+// Today returns the current date in loc
+func Today(loc *time.Location) Date {
+	return Of(time.Now().In(loc))
+}
+
+// Parse reads a date written with Layout
+func Parse(s string) (Date, error) {
+	t, err := time.Parse(Layout, s)
+	if err != nil {
+		return Date{}, err
+	}
+	return Of(t), nil
+}
+
+// ParseMonth reads a month written as 2006-01 and returns its first day
+func ParseMonth(s string) (Date, error) {
+	t, err := time.Parse("2006-01", s)
+	if err != nil {
+		return Date{}, err
+	}
+	return Of(t), nil
+}
+
+// FirstOfMonth returns the first day of d's month
+func (d Date) FirstOfMonth() Date {
+	return New(d.Year, d.Month, 1)
+}
+
+// IsZero reports whether d is no date
+func (d Date) IsZero() bool {
+	return d == Date{}
+}
+
+// Time returns the start of d in UTC, for arithmetic and formatting that doesn't involve a place
+func (d Date) Time() time.Time {
+	if d.IsZero() {
+		return time.Time{}
+	}
+	return time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, time.UTC)
+}
+
+// In returns the moment d starts in loc, such as midnight at the property
+func (d Date) In(loc *time.Location) time.Time {
+	return time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, loc)
+}
+
+// At returns the moment of the clock time hh:mm on d in loc
+func (d Date) At(hour, min int, loc *time.Location) time.Time {
+	return time.Date(d.Year, d.Month, d.Day, hour, min, 0, 0, loc)
+}
+
+// AddDate returns d moved by years, months and days, normalizing like time.AddDate
+func (d Date) AddDate(years, months, days int) Date {
+	return Of(d.Time().AddDate(years, months, days))
+}
+
+// AddDays returns d moved by n days
+func (d Date) AddDays(n int) Date {
+	return d.AddDate(0, 0, n)
+}
+
+// Sub returns the number of days from e to d, the nights of a stay arriving on e and leaving on d
+func (d Date) Sub(e Date) int {
+	return int(d.Time().Sub(e.Time()).Hours() / 24)
+}
+
+// Before reports whether d is an earlier day than e
+func (d Date) Before(e Date) bool {
+	return d.Time().Before(e.Time())
+}
+
+// After reports whether d is a later day than e
+func (d Date) After(e Date) bool {
+	return d.Time().After(e.Time())
+}
+
+// Weekday returns the day of the week of d
+func (d Date) Weekday() time.Weekday {
+	return d.Time().Weekday()
+}
+
+// Format writes d with a time package layout, the time of day parts reading as midnight
+func (d Date) Format(layout string) string {
+	return d.Time().Format(layout)
+}
+
+// String writes d with Layout, or nothing for the zero Date
+func (d Date) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	return d.Format(Layout)
+}
+
+// MarshalText writes d with Layout, so dates keep their day in JSON and in the session
+func (d Date) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText reads a date written by MarshalText
+func (d *Date) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*d = Date{}
+		return nil
+	}
+
+	parsed, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+
+	return nil
+}
+
+// Scan reads a date column. The driver gives dates as midnight UTC, only the day is kept
+func (d *Date) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*d = Date{}
+	case time.Time:
+		*d = Of(v)
+	case string:
+		return d.UnmarshalText([]byte(v))
+	case []byte:
+		return d.UnmarshalText(v)
+	default:
+		return fmt.Errorf("cannot scan %T into a date", src)
+	}
+	return nil
+}
+
+// Value writes d to a date column, the zero Date as NULL
+func (d Date) Value() (driver.Value, error) {
+	if d.IsZero() {
+		return nil, nil
+	}
+	return d.String(), nil
+}
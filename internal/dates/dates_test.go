@@ -0,0 +1,214 @@
+package dates
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSub(t *testing.T) {
+	tests := []struct {
+		name string
+		d, e Date
+		want int
+	}{
+		{"same day", New(2024, 3, 10), New(2024, 3, 10), 0},
+		{"one night", New(2024, 3, 11), New(2024, 3, 10), 1},
+		{"across a month", New(2024, 4, 2), New(2024, 3, 30), 3},
+		{"leap day", New(2024, 3, 1), New(2024, 2, 28), 2},
+		{"no leap day", New(2023, 3, 1), New(2023, 2, 28), 1},
+		{"across a year", New(2025, 1, 2), New(2024, 12, 31), 2},
+		{"backwards", New(2024, 3, 10), New(2024, 3, 15), -5},
+	}
+
+	for _, tt := range tests {
+		if got := tt.d.Sub(tt.e); got != tt.want {
+			t.Errorf("%s: %s.Sub(%s) = %d, want %d", tt.name, tt.d, tt.e, got, tt.want)
+		}
+	}
+}
+
+func TestAddDate(t *testing.T) {
+	tests := []struct {
+		name                string
+		d                   Date
+		years, months, days int
+		want                Date
+	}{
+		{"days", New(2024, 3, 10), 0, 0, 5, New(2024, 3, 15)},
+		{"into next month", New(2024, 1, 30), 0, 0, 3, New(2024, 2, 2)},
+		{"back a day", New(2024, 3, 1), 0, 0, -1, New(2024, 2, 29)},
+		{"month", New(2024, 1, 15), 0, 1, 0, New(2024, 2, 15)},
+		{"month end normalizes", New(2024, 1, 31), 0, 1, 0, New(2024, 3, 2)},
+		{"year from leap day", New(2024, 2, 29), 1, 0, 0, New(2025, 3, 1)},
+		{"across a year", New(2024, 12, 31), 0, 0, 1, New(2025, 1, 1)},
+	}
+
+	for _, tt := range tests {
+		if got := tt.d.AddDate(tt.years, tt.months, tt.days); got != tt.want {
+			t.Errorf("%s: %s.AddDate(%d, %d, %d) = %s, want %s", tt.name, tt.d, tt.years, tt.months, tt.days, got, tt.want)
+		}
+	}
+}
+
+func TestAddDays(t *testing.T) {
+	d := New(2024, 3, 10)
+
+	for _, n := range []int{-400, -31, -1, 0, 1, 30, 365} {
+		if got := d.AddDays(n).Sub(d); got != n {
+			t.Errorf("%s.AddDays(%d) is %d days away", d, n, got)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		year       int
+		month      time.Month
+		day        int
+		want       Date
+		wantString string
+	}{
+		{2024, 3, 10, Date{2024, 3, 10}, "2024-03-10"},
+		{2024, 2, 30, Date{2024, 3, 1}, "2024-03-01"},
+		{2024, 13, 1, Date{2025, 1, 1}, "2025-01-01"},
+		{2024, 3, 0, Date{2024, 2, 29}, "2024-02-29"},
+	}
+
+	for _, tt := range tests {
+		got := New(tt.year, tt.month, tt.day)
+		if got != tt.want {
+			t.Errorf("New(%d, %d, %d) = %#v, want %#v", tt.year, tt.month, tt.day, got, tt.want)
+		}
+		if got.String() != tt.wantString {
+			t.Errorf("New(%d, %d, %d).String() = %q, want %q", tt.year, tt.month, tt.day, got.String(), tt.wantString)
+		}
+	}
+}
+
+func TestOf(t *testing.T) {
+	lima := time.FixedZone("Lima", -5*60*60)
+	tokyo := time.FixedZone("Tokyo", 9*60*60)
+
+	// the same moment falls on different days at different places
+	moment := time.Date(2024, 3, 10, 2, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want Date
+	}{
+		{"utc", moment, New(2024, 3, 10)},
+		{"behind utc", moment.In(lima), New(2024, 3, 9)},
+		{"ahead of utc", moment.In(tokyo), New(2024, 3, 10)},
+		{"last second of the day", time.Date(2024, 3, 10, 23, 59, 59, 0, lima), New(2024, 3, 10)},
+		{"zero time", time.Time{}, Date{}},
+	}
+
+	for _, tt := range tests {
+		if got := Of(tt.t); got != tt.want {
+			t.Errorf("%s: Of(%v) = %s, want %s", tt.name, tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Date
+		wantErr bool
+	}{
+		{"2024-03-10", New(2024, 3, 10), false},
+		{"2024-02-29", New(2024, 2, 29), false},
+		{"2023-02-29", Date{}, true},
+		{"10/03/2024", Date{}, true},
+		{"", Date{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseMonth(t *testing.T) {
+	got, err := ParseMonth("2024-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != New(2024, 2, 1) {
+		t.Errorf("ParseMonth(\"2024-02\") = %s, want 2024-02-01", got)
+	}
+
+	if _, err := ParseMonth("2024-13"); err == nil {
+		t.Error("ParseMonth(\"2024-13\") gave no error")
+	}
+}
+
+func TestBeforeAfter(t *testing.T) {
+	tests := []struct {
+		d, e          Date
+		before, after bool
+	}{
+		{New(2024, 3, 9), New(2024, 3, 10), true, false},
+		{New(2024, 3, 10), New(2024, 3, 10), false, false},
+		{New(2024, 4, 1), New(2024, 3, 31), false, true},
+		{New(2023, 12, 31), New(2024, 1, 1), true, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.d.Before(tt.e); got != tt.before {
+			t.Errorf("%s.Before(%s) = %v, want %v", tt.d, tt.e, got, tt.before)
+		}
+		if got := tt.d.After(tt.e); got != tt.after {
+			t.Errorf("%s.After(%s) = %v, want %v", tt.d, tt.e, got, tt.after)
+		}
+	}
+}
+
+func TestText(t *testing.T) {
+	for _, d := range []Date{New(2024, 3, 10), {}} {
+		text, err := d.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got Date
+		if err := got.UnmarshalText(text); err != nil {
+			t.Fatalf("UnmarshalText(%q): %v", text, err)
+		}
+		if got != d {
+			t.Errorf("%#v came back from %q as %#v", d, text, got)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     interface{}
+		want    Date
+		wantErr bool
+	}{
+		{"null", nil, Date{}, false},
+		{"time", time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC), New(2024, 3, 10), false},
+		{"string", "2024-03-10", New(2024, 3, 10), false},
+		{"bytes", []byte("2024-03-10"), New(2024, 3, 10), false},
+		{"number", 20240310, Date{}, true},
+	}
+
+	for _, tt := range tests {
+		var got Date
+		err := got.Scan(tt.src)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Scan error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("%s: Scan(%v) = %s, want %s", tt.name, tt.src, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+// Write writes a single record and flushes it so large exports stream to the client
+func (c *csvWriter) Write(row []string) error {
+	record := make([]string, len(row))
+	for i, value := range row {
+		record[i] = safeCell(value)
+	}
+
+	if err := c.w.Write(record); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
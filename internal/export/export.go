@@ -0,0 +1,46 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Writer writes tabular rows to an underlying stream
+type Writer interface {
+	Write(row []string) error
+	Close() error
+}
+
+// Formats supported by NewWriter
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// ContentTypes maps an export format to its mime type
+var ContentTypes = map[string]string{
+	FormatCSV:  "text/csv",
+	FormatXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// NewWriter returns a writer for the given format
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w), nil
+	case FormatXLSX:
+		return newXLSXWriter(w)
+	default:
+		return nil, fmt.Errorf("unsupported export format %q", format)
+	}
+}
+
+// safeCell keeps spreadsheet programs from running a value as a formula, such as a guest named
+// "=HYPERLINK(...)", by starting the values they would read as one with a quote
+func safeCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
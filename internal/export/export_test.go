@@ -0,0 +1,43 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSafeCell(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Smith", "Smith"},
+		{"", ""},
+		{"=HYPERLINK(\"http://example.com\")", "'=HYPERLINK(\"http://example.com\")"},
+		{"+1 555 0100", "'+1 555 0100"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"a=b", "a=b"},
+	}
+
+	for _, tt := range tests {
+		if got := safeCell(tt.in); got != tt.want {
+			t.Errorf("safeCell(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := newCSVWriter(&buf)
+
+	if err := w.Write([]string{"1", "=cmd", "Ann"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := buf.String(), "1,'=cmd,Ann\n"; got != want {
+		t.Errorf("wrote %q, want %q", got, want)
+	}
+}
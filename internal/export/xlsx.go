@@ -0,0 +1,99 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"io"
+)
+
+// the static parts of a minimal workbook with a single worksheet
+var xlsxParts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`},
+}
+
+const sheetHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+
+const sheetFooter = `</sheetData></worksheet>`
+
+// xlsxWriter streams rows into the worksheet entry of a zip archive, so the
+// whole sheet never has to be held in memory
+type xlsxWriter struct {
+	zw    *zip.Writer
+	sheet io.Writer
+}
+
+func newXLSXWriter(w io.Writer) (*xlsxWriter, error) {
+	zw := zip.NewWriter(w)
+
+	for _, part := range xlsxParts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	// the worksheet is written last so it can stay open while rows are streamed
+	sheet, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(sheet, sheetHeader); err != nil {
+		return nil, err
+	}
+
+	return &xlsxWriter{zw: zw, sheet: sheet}, nil
+}
+
+// Write appends a row of inline string cells
+func (x *xlsxWriter) Write(row []string) error {
+	if _, err := io.WriteString(x.sheet, "<row>"); err != nil {
+		return err
+	}
+
+	for _, value := range row {
+		if _, err := io.WriteString(x.sheet, `<c t="inlineStr"><is><t>`); err != nil {
+			return err
+		}
+		if err := xml.EscapeText(x.sheet, []byte(safeCell(value))); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(x.sheet, "</t></is></c>"); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(x.sheet, "</row>")
+	return err
+}
+
+func (x *xlsxWriter) Close() error {
+	if _, err := io.WriteString(x.sheet, sheetFooter); err != nil {
+		return err
+	}
+	return x.zw.Close()
+}
@@ -1,17 +1,29 @@
 package forms
 
-type errors map[string][]string
+import "github.com/chelobotix/booking-go/internal/i18n"
 
-// Add adds an error message for a given form field
-func (e errors) Add(field, message string) {
+type errors map[string][]i18n.Message
+
+// Add adds an error message for a given form field, formatted with args when it is shown
+func (e errors) Add(field, message string, args ...interface{}) {
+	e[field] = append(e[field], i18n.M(message, args...))
+}
+
+// AddMessage adds an error message that was already built with its arguments, such as a broken rule
+func (e errors) AddMessage(field string, message i18n.Message) {
 	e[field] = append(e[field], message)
 }
 
 // Get returns first error message for a field
 func (e errors) Get(field string) string {
+	return e.Message(field).String()
+}
+
+// Message returns the first error message for a field untranslated, the zero Message when there is none
+func (e errors) Message(field string) i18n.Message {
 	es := e[field]
 	if len(es) == 0 {
-		return ""
+		return i18n.Message{}
 	}
 	return es[0]
 }
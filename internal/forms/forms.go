@@ -1,11 +1,13 @@
 package forms
 
 import (
-	"fmt"
 	"github.com/asaskevich/govalidator"
+	"github.com/chelobotix/booking-go/internal/i18n"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Form creates a custom form struct and embeds a url.Values object
@@ -23,7 +25,7 @@ func (f *Form) Valid() bool {
 func New(data url.Values) *Form {
 	return &Form{
 		data,
-		errors(map[string][]string{}),
+		errors(map[string][]i18n.Message{}),
 	}
 }
 
@@ -50,7 +52,7 @@ func (f *Form) Has(field string, r *http.Request) bool {
 func (f *Form) MinLength(field string, length int) bool {
 	x := f.Get(field)
 	if len(x) < length {
-		f.Errors.Add(field, fmt.Sprintf("This field must be at least %d characters long", length))
+		f.Errors.Add(field, "This field must be at least %d characters long", length)
 		return false
 	}
 	return true
@@ -61,3 +63,38 @@ func (f *Form) IsEmail(field string) {
 		f.Errors.Add(field, "Invalid email address")
 	}
 }
+
+// IsDate checks that a field holds a date in the given layout
+func (f *Form) IsDate(field, layout string) bool {
+	if _, err := time.Parse(layout, f.Get(field)); err != nil {
+		f.Errors.Add(field, "Invalid date")
+		return false
+	}
+	return true
+}
+
+// IsInt checks that a field holds a whole number
+func (f *Form) IsInt(field string) bool {
+	if _, err := strconv.Atoi(f.Get(field)); err != nil {
+		f.Errors.Add(field, "This field must be a number")
+		return false
+	}
+	return true
+}
+
+// DateRange checks that both fields hold dates in the given layout and that the end date is after the start date
+func (f *Form) DateRange(startField, endField, layout string) bool {
+	validStart := f.IsDate(startField, layout)
+	validEnd := f.IsDate(endField, layout)
+	if !validStart || !validEnd {
+		return false
+	}
+
+	startDate, _ := time.Parse(layout, f.Get(startField))
+	endDate, _ := time.Parse(layout, f.Get(endField))
+	if !endDate.After(startDate) {
+		f.Errors.Add(endField, "Departure must be after arrival")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,539 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/chelobotix/booking-go/internal/currency"
+	"github.com/chelobotix/booking-go/internal/dates"
+	"github.com/chelobotix/booking-go/internal/forms"
+	"github.com/chelobotix/booking-go/internal/helpers"
+	"github.com/chelobotix/booking-go/internal/i18n"
+	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/chelobotix/booking-go/internal/payments"
+	"github.com/chelobotix/booking-go/internal/pricing"
+	"github.com/chelobotix/booking-go/internal/render"
+	"github.com/chelobotix/booking-go/internal/repository"
+	"github.com/chelobotix/booking-go/internal/rules"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// GuestRegister shows the form to open a guest account
+func (repo *Repository) GuestRegister(w http.ResponseWriter, r *http.Request) {
+	var guest models.Reservation
+	err := repo.prefillGuest(r, &guest)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["guest"] = guest
+
+	render.Template(w, r, "guest-register.page.gohtml", &models.TemplateData{
+		Form: forms.New(nil),
+		Data: data,
+	})
+}
+
+// PostGuestRegister opens a guest account and emails the link confirming the guest owns the
+// address. The account can only be used, and bookings made before with the email only show up,
+// once the link is followed
+func (repo *Repository) PostGuestRegister(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	guest := models.Reservation{
+		FirstName: r.Form.Get("first_name"),
+		LastName:  r.Form.Get("last_name"),
+		Email:     r.Form.Get("email"),
+		Phone:     r.Form.Get("phone"),
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("first_name", "last_name", "email", "password")
+	form.IsEmail("email")
+	form.MinLength("password", 8)
+	if form.Get("password") != form.Get("password_confirm") {
+		form.Errors.Add("password_confirm", "The passwords don't match")
+	}
+
+	var token string
+	if form.Valid() {
+		token, err = repo.auditedDB(r).RegisterGuest(models.Guest{
+			FirstName: guest.FirstName,
+			LastName:  guest.LastName,
+			Email:     guest.Email,
+			Phone:     guest.Phone,
+		}, form.Get("password"))
+		if errors.Is(err, repository.ErrGuestRegistered) {
+			form.Errors.Add("email", "This email already has an account, log in instead")
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		data := make(map[string]interface{})
+		data["guest"] = guest
+
+		render.Template(w, r, "guest-register.page.gohtml", &models.TemplateData{
+			Form: form,
+			Data: data,
+		})
+		return
+	}
+
+	repo.sendGuestVerification(r, guest.FirstName, guest.Email, token)
+
+	repo.AppConfig.Session.Put(r.Context(), "flash", "We sent you an email, follow the link in it to finish opening your account")
+	http.Redirect(w, r, "/account/login", http.StatusSeeOther)
+}
+
+// sendGuestVerification emails the link confirming a guest owns their email address
+func (repo *Repository) sendGuestVerification(r *http.Request, firstName, email, token string) {
+	link := fmt.Sprintf("%s/account/verify/%s", repo.AppConfig.SiteURL, token)
+
+	t, _ := repo.translator(locale(r))
+
+	htmlMessage := fmt.Sprintf(`
+		<strong>%s</strong><br>
+		%s <br>
+		%s<br>
+		<a href="%s">%s</a>
+	`, t("Confirm your email"), t("Dear %s,", firstName),
+		t("Follow the link below within two days to finish opening your account. If you didn't ask for an account, ignore this email."),
+		link, t("Confirm my email"))
+
+	repo.AppConfig.MailChan <- models.MailData{
+		To:       email,
+		From:     "me@gmail.com",
+		Subject:  t("Confirm your email"),
+		Content:  htmlMessage,
+		Template: "basic.html",
+	}
+}
+
+// GuestVerifyEmail confirms a guest's email from the link sent when they registered and logs them in
+func (repo *Repository) GuestVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	id, err := repo.auditedDB(r).VerifyGuestEmail(chi.URLParam(r, "token"))
+	if errors.Is(err, sql.ErrNoRows) {
+		repo.AppConfig.Session.Put(r.Context(), "error", "This link has expired, register again to get a new one")
+		http.Redirect(w, r, "/account/register", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	guest, err := repo.DB.GetGuest(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	_ = repo.AppConfig.Session.RenewToken(r.Context())
+	repo.AppConfig.Session.Put(r.Context(), "guest_id", id)
+	repo.rememberGuest(r, guest.Email)
+	repo.AppConfig.Session.Put(r.Context(), "flash", "Welcome, your account is ready")
+	http.Redirect(w, r, "/account/bookings", http.StatusSeeOther)
+}
+
+// GuestLogin shows the guest login form
+func (repo *Repository) GuestLogin(w http.ResponseWriter, r *http.Request) {
+	render.Template(w, r, "guest-login.page.gohtml", &models.TemplateData{
+		Form: forms.New(nil),
+	})
+}
+
+// PostGuestLogin logs a guest in
+func (repo *Repository) PostGuestLogin(w http.ResponseWriter, r *http.Request) {
+	_ = repo.AppConfig.Session.RenewToken(r.Context())
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	email := r.Form.Get("email")
+	password := r.Form.Get("password")
+
+	form := forms.New(r.PostForm)
+	form.Required("email", "password")
+	form.IsEmail("email")
+	if !form.Valid() {
+		render.Template(w, r, "guest-login.page.gohtml", &models.TemplateData{
+			Form: form,
+		})
+		return
+	}
+
+	id, err := repo.DB.AuthenticateGuest(email, password)
+	if errors.Is(err, repository.ErrGuestUnverified) {
+		guest, token, err := repo.auditedDB(r).RenewGuestVerification(id)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		repo.sendGuestVerification(r, guest.FirstName, guest.Email, token)
+
+		repo.AppConfig.Session.Put(r.Context(), "warning", "Confirm your email first, we sent you a new link")
+		http.Redirect(w, r, "/account/login", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		repo.AppConfig.Session.Put(r.Context(), "error", "Invalid login credentials")
+		http.Redirect(w, r, "/account/login", http.StatusSeeOther)
+		return
+	}
+
+	repo.AppConfig.Session.Put(r.Context(), "guest_id", id)
+	repo.rememberGuest(r, email)
+	repo.AppConfig.Session.Put(r.Context(), "flash", "Logged in successfully")
+	http.Redirect(w, r, "/account/bookings", http.StatusSeeOther)
+}
+
+// GuestLogout logs the guest out, leaving any staff login in the same browser alone
+func (repo *Repository) GuestLogout(w http.ResponseWriter, r *http.Request) {
+	repo.AppConfig.Session.Remove(r.Context(), "guest_id")
+	repo.AppConfig.Session.Remove(r.Context(), "guest_email")
+	_ = repo.AppConfig.Session.RenewToken(r.Context())
+
+	http.Redirect(w, r, "/account/login", http.StatusSeeOther)
+}
+
+// MyBookings lists the logged in guest's reservations
+func (repo *Repository) MyBookings(w http.ResponseWriter, r *http.Request) {
+	guestId := repo.AppConfig.Session.GetInt(r.Context(), "guest_id")
+
+	guest, err := repo.DB.GetGuest(guestId)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	reservations, err := repo.DB.GetGuestReservations(guestId)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["guest"] = guest
+	data["reservations"] = reservations
+	data["today"] = repo.today()
+
+	render.Template(w, r, "my-bookings.page.gohtml", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// guestReservation returns the reservation in the URL when it belongs to the logged in guest.
+// It writes the error response and returns false otherwise
+func (repo *Repository) guestReservation(w http.ResponseWriter, r *http.Request) (models.Reservation, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return models.Reservation{}, false
+	}
+
+	res, err := repo.DB.GetReservation(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return res, false
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return res, false
+	}
+
+	// someone else's booking is reported as missing so ids can't be probed
+	if res.GuestID == 0 || res.GuestID != repo.AppConfig.Session.GetInt(r.Context(), "guest_id") {
+		helpers.ClientError(w, http.StatusNotFound)
+		return res, false
+	}
+
+	return res, true
+}
+
+// changeable reports whether a guest can still change or cancel res themselves on today
+func changeable(res models.Reservation, today dates.Date) bool {
+	return res.DeletedAt.IsZero() && res.StartDate.After(today)
+}
+
+// MyBooking shows one of the guest's reservations with the forms to change or cancel it
+func (repo *Repository) MyBooking(w http.ResponseWriter, r *http.Request) {
+	res, ok := repo.guestReservation(w, r)
+	if !ok {
+		return
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["start_date"] = res.StartDate.Format("2006-01-02")
+	stringMap["end_date"] = res.EndDate.Format("2006-01-02")
+
+	repo.renderMyBooking(w, r, res, stringMap, forms.New(nil))
+}
+
+// PostMyBooking moves one of the guest's reservations to new dates in the same room. The stay is
+// checked against the booking rules and availability again and repriced at the current rate. When
+// the new total needs a bigger deposit the difference is charged to the guest's card, when it is
+// less than what was paid the difference is refunded. A stay already inside the penalty period of
+// its cancellation policy can't be moved, or moving it out would make cancelling free
+func (repo *Repository) PostMyBooking(w http.ResponseWriter, r *http.Request) {
+	res, ok := repo.guestReservation(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["start_date"] = r.Form.Get("start_date")
+	stringMap["end_date"] = r.Form.Get("end_date")
+
+	if !changeable(res, repo.today()) {
+		repo.AppConfig.Session.Put(r.Context(), "error", "This booking can no longer be changed online, please contact us")
+		http.Redirect(w, r, fmt.Sprintf("/account/bookings/%d", res.ID), http.StatusSeeOther)
+		return
+	}
+
+	if penalty, _ := cancellationTerms(res, repo.now()); penalty > 0 {
+		repo.AppConfig.Session.Put(r.Context(), "error", "This booking is inside its cancellation period and can no longer be changed online, please contact us")
+		http.Redirect(w, r, fmt.Sprintf("/account/bookings/%d", res.ID), http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("start_date", "end_date")
+
+	if form.DateRange("start_date", "end_date", "2006-01-02") {
+		res.StartDate, _ = dates.Parse(form.Get("start_date"))
+		res.EndDate, _ = dates.Parse(form.Get("end_date"))
+
+		bookingRules, err := repo.DB.GetBookingRules()
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		addViolations(form, rules.Check(bookingRules, res.RoomID, res.StartDate, res.EndDate, repo.now()), "start_date", "end_date")
+	}
+
+	if form.Valid() {
+		err = repo.repriceReservation(&res)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		// the deposit for the new total is taken now, like when booking
+		if due := payments.Deposit(res.Total, repo.AppConfig.DepositPercent) - res.Paid; due > 0 {
+			checkCard(form, repo.now())
+			if form.Valid() {
+				res.Payments, err = repo.chargeCard(form, due, res.Currency,
+					fmt.Sprintf("%s from %s", res.Room.RoomName, res.StartDate.Format("2006-01-02")), "Deposit on date change")
+				if err != nil {
+					helpers.ServerError(w, err)
+					return
+				}
+			}
+		}
+	}
+
+	if form.Valid() {
+		err = repo.auditedDB(r).UpdateReservation(res)
+		if err != nil {
+			repo.voidPayments(res.Payments, res.Currency)
+		}
+		if errors.Is(err, repository.ErrStayChanged) {
+			repo.AppConfig.Session.Put(r.Context(), "error", "This booking was already cancelled")
+			http.Redirect(w, r, "/account/bookings", http.StatusSeeOther)
+			return
+		}
+		if errors.Is(err, repository.ErrNotAvailable) {
+			form.Errors.Add("start_date", "The room is not available for these dates")
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		repo.renderMyBooking(w, r, res, stringMap, form)
+		return
+	}
+
+	for _, p := range res.Payments {
+		res.Paid += p.Amount
+	}
+
+	if res.Paid > res.Total {
+		refunded, err := repo.refundPaid(r, res, res.Paid-res.Total, "Refund on date change")
+		res.Paid -= refunded
+		if err != nil {
+			// the booking is changed either way, staff finish the refund
+			repo.AppConfig.ErrorLog.Println(err)
+			repo.AppConfig.Session.Put(r.Context(), "warning", "We will contact you about refunding the difference")
+		}
+	}
+
+	// the old dates may be what someone on the waitlist is after
+	go repo.ProcessWaitlist()
+
+	t, date := repo.translator(locale(r))
+
+	htmlMessage := fmt.Sprintf(`
+		<strong>%s</strong><br>
+		%s <br>
+		%s<br>
+		%s<br>
+		%s
+	`, t("Reservation Updated"), t("Dear %s,", res.FirstName),
+		t("Your reservation of room %s has been changed to %s to %s.", res.Room.RoomName, date(res.StartDate), date(res.EndDate)),
+		t("Check-in is from %s and check-out is by %s.", res.Room.CheckInTime, res.Room.CheckOutTime),
+		t("New total: %s, paid: %s, due on arrival: %s", currency.Price(res.Total, res.Currency), currency.Price(res.Paid, res.Currency),
+			currency.Price(res.Balance(), res.Currency)))
+
+	repo.AppConfig.MailChan <- models.MailData{
+		To:       res.Email,
+		From:     "me@gmail.com",
+		Subject:  t("Reservation Updated"),
+		Content:  htmlMessage,
+		Template: "basic.html",
+	}
+
+	repo.AppConfig.Session.Put(r.Context(), "flash", i18n.M("Your booking was changed, the new total is %s", currency.Price(res.Total, res.Currency)))
+	http.Redirect(w, r, fmt.Sprintf("/account/bookings/%d", res.ID), http.StatusSeeOther)
+}
+
+// repriceReservation prices res for its new dates at its room's current rate. The promo code it
+// was booked with still applies if it is valid for the new stay; it was already redeemed by this
+// reservation so its use limit is not checked again
+func (repo *Repository) repriceReservation(res *models.Reservation) error {
+	room, err := repo.DB.GetRoomById(res.RoomID)
+	if err != nil {
+		return err
+	}
+
+	var promo *models.PromoCode
+
+	if res.PromoCode != "" {
+		found, err := repo.DB.GetPromoCodeByCode(res.PromoCode)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		found.MaxUses = 0
+		if err == nil && pricing.CheckPromo(found, res.RoomID, res.StartDate, res.EndDate, repo.now()).Key == "" {
+			promo = &found
+		}
+	}
+
+	pricing.Apply(res, room, promo)
+
+	return nil
+}
+
+// PostCancelMyBooking cancels one of the guest's reservations under the policy it was booked
+// with, refunding what the policy gives back
+func (repo *Repository) PostCancelMyBooking(w http.ResponseWriter, r *http.Request) {
+	res, ok := repo.guestReservation(w, r)
+	if !ok {
+		return
+	}
+
+	if !changeable(res, repo.today()) {
+		repo.AppConfig.Session.Put(r.Context(), "error", "This booking can no longer be cancelled online, please contact us")
+		http.Redirect(w, r, fmt.Sprintf("/account/bookings/%d", res.ID), http.StatusSeeOther)
+		return
+	}
+
+	err := repo.auditedDB(r).DeleteReservation(res.ID)
+	if errors.Is(err, repository.ErrStayChanged) {
+		repo.AppConfig.Session.Put(r.Context(), "error", "This booking was already cancelled")
+		http.Redirect(w, r, "/account/bookings", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	go repo.ProcessWaitlist()
+
+	penalty, _ := cancellationTerms(res, repo.now())
+
+	refunded, err := repo.refundCancellation(r, res)
+	if err != nil {
+		// the booking is cancelled either way, staff finish the refund from the trash
+		repo.AppConfig.ErrorLog.Println(err)
+	}
+
+	t, date := repo.translator(locale(r))
+
+	htmlMessage := fmt.Sprintf(`
+		<strong>%s</strong><br>
+		%s <br>
+		%s<br>
+		%s
+	`, t("Reservation Cancelled"), t("Dear %s,", res.FirstName),
+		t("Your reservation of room %s from %s to %s has been cancelled.", res.Room.RoomName, date(res.StartDate), date(res.EndDate)),
+		t("Cancellation penalty: %s, refunded: %s", currency.Price(penalty, res.Currency), currency.Price(refunded, res.Currency)))
+
+	repo.AppConfig.MailChan <- models.MailData{
+		To:       res.Email,
+		From:     "me@gmail.com",
+		Subject:  t("Reservation Cancelled"),
+		Content:  htmlMessage,
+		Template: "basic.html",
+	}
+
+	if err != nil {
+		repo.AppConfig.Session.Put(r.Context(), "warning", "Your booking was cancelled, we will contact you about the refund")
+	} else {
+		repo.AppConfig.Session.Put(r.Context(), "flash", i18n.M("Your booking was cancelled, %s refunded", currency.Price(refunded, res.Currency)))
+	}
+	http.Redirect(w, r, "/account/bookings", http.StatusSeeOther)
+}
+
+// renderMyBooking renders the page of one of the guest's reservations
+func (repo *Repository) renderMyBooking(w http.ResponseWriter, r *http.Request, res models.Reservation, stringMap map[string]string, form *forms.Form) {
+	penalty, refund := cancellationTerms(res, repo.now())
+
+	intMap := make(map[string]int)
+	intMap["cancel_penalty"] = penalty
+	intMap["cancel_refund"] = refund
+	if changeable(res, repo.today()) {
+		intMap["changeable"] = 1
+		// inside the penalty period the dates stay, see PostMyBooking
+		if penalty == 0 {
+			intMap["reschedulable"] = 1
+		}
+	}
+	intMap["deposit_percent"] = repo.AppConfig.DepositPercent
+
+	data := make(map[string]interface{})
+	data["reservation"] = res
+
+	render.Template(w, r, "my-booking.page.gohtml", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+		IntMap:    intMap,
+		Form:      form,
+	})
+}
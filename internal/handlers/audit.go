@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/chelobotix/booking-go/internal/helpers"
+	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/chelobotix/booking-go/internal/render"
+	"github.com/chelobotix/booking-go/internal/repository"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// actor identifies who is making the request, the logged in user or else the guest's session.
+// The session token is hashed so the audit log never holds a usable token
+func (repo *Repository) actor(r *http.Request) models.Actor {
+	actor := models.Actor{IP: r.RemoteAddr}
+
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		actor.IP = host
+	}
+
+	if id, ok := repo.AppConfig.Session.Get(r.Context(), "user_id").(int); ok {
+		actor.UserID = id
+		return actor
+	}
+
+	if token := repo.AppConfig.Session.Token(r.Context()); token != "" {
+		sum := sha256.Sum256([]byte(token))
+		actor.GuestToken = hex.EncodeToString(sum[:8])
+	}
+
+	return actor
+}
+
+// auditedDB returns the database repository with writes recorded against the request's actor
+func (repo *Repository) auditedDB(r *http.Request) repository.DatabaseRepo {
+	return repo.DB.WithActor(repo.actor(r))
+}
+
+// AdminAuditLog shows the audit trail, optionally filtered by entity, action or user
+func (repo *Repository) AdminAuditLog(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	filter := models.AuditFilter{
+		Entity:  q.Get("entity"),
+		Action:  q.Get("action"),
+		Page:    1,
+		PerPage: models.DefaultPerPage,
+	}
+
+	if id, err := strconv.Atoi(q.Get("entity_id")); err == nil {
+		filter.EntityID = id
+	}
+
+	if id, err := strconv.Atoi(q.Get("user_id")); err == nil {
+		filter.UserID = id
+	}
+
+	if page, err := strconv.Atoi(q.Get("page")); err == nil && page > 0 {
+		filter.Page = page
+	}
+
+	logs, err := repo.DB.GetAuditLogs(filter)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["logs"] = logs
+
+	kept := url.Values{}
+	stringMap := make(map[string]string)
+	for _, key := range []string{"entity", "entity_id", "action", "user_id"} {
+		stringMap[key] = q.Get(key)
+		if q.Get(key) != "" {
+			kept.Set(key, q.Get(key))
+		}
+	}
+	stringMap["query"] = kept.Encode()
+
+	intMap := make(map[string]int)
+	intMap["page"] = filter.Page
+	if len(logs) == filter.PerPage {
+		intMap["has_next"] = 1
+	}
+
+	render.Template(w, r, "admin-audit.page.gohtml", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+		IntMap:    intMap,
+	})
+}
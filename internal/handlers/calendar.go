@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/chelobotix/booking-go/internal/dates"
+	"github.com/chelobotix/booking-go/internal/helpers"
+	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+)
+
+// maxCalendarMonths caps how many months one calendar request may cover
+const maxCalendarMonths = 12
+
+type calendarDay struct {
+	Date      string `json:"date"`
+	Available bool   `json:"available"`
+}
+
+type calendarResponse struct {
+	RoomID int           `json:"room_id"`
+	From   string        `json:"from"`
+	To     string        `json:"to"`
+	Days   []calendarDay `json:"days"`
+}
+
+// RoomAvailabilityJSON returns, for each night from the first of month "from" (YYYY-MM, default this
+// month) through the end of month "to" (default the same month), whether a room can be booked.
+// Only the nights are exposed, never who or what is occupying them
+func (repo *Repository) RoomAvailabilityJSON(w http.ResponseWriter, r *http.Request) {
+	roomId, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	today := repo.today()
+
+	from := today.FirstOfMonth()
+	if q := r.URL.Query().Get("from"); q != "" {
+		from, err = dates.ParseMonth(q)
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	to := from
+	if q := r.URL.Query().Get("to"); q != "" {
+		to, err = dates.ParseMonth(q)
+		if err != nil || to.Before(from) {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+	if to.After(from.AddDate(0, maxCalendarMonths-1, 0)) {
+		to = from.AddDate(0, maxCalendarMonths-1, 0)
+	}
+
+	// the day after the last night shown
+	end := to.AddDate(0, 1, 0)
+
+	room, err := repo.DB.GetRoomById(roomId)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// a restriction keeps the room empty for its turnover gap either side, so the nights just
+	// outside the calendar can still close days inside it
+	gap := room.TurnoverGap()
+
+	restrictions, err := repo.DB.GetRestrictionsForRoomByDate(roomId, from.AddDays(-gap), end.AddDays(gap))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	taken := make(map[string]bool)
+	for _, restriction := range restrictions {
+		// cleaning restrictions are the buffer already
+		around := gap
+		if restriction.RestrictionID == models.RestrictionCleaning {
+			around = 0
+		}
+
+		for d := restriction.StartDate.AddDays(-around); d.Before(restriction.EndDate.AddDays(around)); d = d.AddDays(1) {
+			taken[d.String()] = true
+		}
+	}
+
+	response := calendarResponse{
+		RoomID: roomId,
+		From:   from.String(),
+		To:     end.AddDays(-1).String(),
+	}
+
+	for d := from; d.Before(end); d = d.AddDays(1) {
+		date := d.String()
+		response.Days = append(response.Days, calendarDay{
+			Date:      date,
+			Available: !d.Before(today) && !taken[date] && room.Status != models.RoomOutOfOrder,
+		})
+	}
+
+	out, err := json.Marshal(response)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"github.com/chelobotix/booking-go/internal/dates"
+	"time"
+)
+
+// now is the current time at the property
+func (repo *Repository) now() time.Time {
+	return time.Now().In(repo.AppConfig.TimeZone)
+}
+
+// today is the current date at the property, the day arrivals and departures are counted from
+func (repo *Repository) today() dates.Date {
+	return dates.Of(repo.now())
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"github.com/chelobotix/booking-go/internal/forms"
+	"github.com/chelobotix/booking-go/internal/helpers"
+	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/chelobotix/booking-go/internal/render"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// currencyCode matches an ISO 4217 code such as EUR
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// PostCurrency switches the currency prices are shown in and goes back to the page the guest was on
+func (repo *Repository) PostCurrency(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	code := r.Form.Get("currency")
+	if _, ok := repo.AppConfig.Currencies.Get(code); ok {
+		repo.AppConfig.Session.Put(r.Context(), "currency", code)
+	}
+
+	http.Redirect(w, r, localPath(r.Form.Get("back")), http.StatusSeeOther)
+}
+
+// localPath returns back when it is a path on this site and the home page otherwise, so a form
+// can't send guests somewhere else. Browsers read a backslash as a slash, so "/\evil.com" is
+// turned away along with "//evil.com"
+func localPath(back string) string {
+	u, err := url.Parse(back)
+	if err != nil || u.Scheme != "" || u.Host != "" || !strings.HasPrefix(back, "/") ||
+		strings.HasPrefix(back, "//") || strings.Contains(back, "\\") {
+		return "/"
+	}
+	return back
+}
+
+// reloadCurrencies reads the currencies again after staff changed one
+func (repo *Repository) reloadCurrencies() error {
+	currencies, err := repo.DB.AllCurrencies()
+	if err != nil {
+		return err
+	}
+
+	repo.AppConfig.Currencies.Load(currencies)
+
+	return nil
+}
+
+// AdminCurrencies lists the currencies with their exchange rates and a form to add one
+func (repo *Repository) AdminCurrencies(w http.ResponseWriter, r *http.Request) {
+	c := models.Currency{
+		Decimals: 2,
+		RoundTo:  1,
+	}
+
+	repo.renderCurrencies(w, r, c, forms.New(nil))
+}
+
+// currencyFromForm reads and checks the symbol, rate and rounding of a currency
+func currencyFromForm(form *forms.Form, c *models.Currency) {
+	form.Required("rate", "decimals", "round_to")
+
+	c.Symbol = strings.TrimSpace(form.Get("symbol"))
+
+	if form.Get("rate") != "" {
+		rate, err := strconv.ParseFloat(form.Get("rate"), 64)
+		if err != nil || rate <= 0 {
+			form.Errors.Add("rate", "Enter a rate above 0")
+		}
+		c.Rate = rate
+	}
+
+	if form.Get("decimals") != "" && form.IsInt("decimals") {
+		c.Decimals, _ = strconv.Atoi(form.Get("decimals"))
+		if c.Decimals < 0 || c.Decimals > 3 {
+			form.Errors.Add("decimals", "Enter between 0 and 3 decimals")
+		}
+	}
+
+	if form.Get("round_to") != "" && form.IsInt("round_to") {
+		c.RoundTo, _ = strconv.Atoi(form.Get("round_to"))
+		if c.RoundTo < 1 {
+			form.Errors.Add("round_to", "Enter 1 or more")
+		}
+	}
+}
+
+// AdminPostCurrency adds a currency prices can be shown in
+func (repo *Repository) AdminPostCurrency(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("code")
+
+	c := models.Currency{
+		Code:   strings.ToUpper(strings.TrimSpace(r.Form.Get("code"))),
+		Active: true,
+	}
+	if c.Code != "" && !currencyCode.MatchString(c.Code) {
+		form.Errors.Add("code", "Enter a three letter code such as EUR")
+	}
+	if _, ok := repo.AppConfig.Currencies.Get(c.Code); ok {
+		form.Errors.Add("code", "This currency already exists")
+	}
+	currencyFromForm(form, &c)
+
+	if !form.Valid() {
+		repo.renderCurrencies(w, r, c, form)
+		return
+	}
+
+	_, err = repo.auditedDB(r).InsertCurrency(c)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if err := repo.reloadCurrencies(); err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.AppConfig.Session.Put(r.Context(), "flash", "Currency added")
+	http.Redirect(w, r, "/admin/currencies", http.StatusSeeOther)
+}
+
+// AdminPostUpdateCurrency changes the exchange rate and rounding of a currency. The base currency's
+// rate stays 1
+func (repo *Repository) AdminPostUpdateCurrency(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	c, err := repo.DB.GetCurrency(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	currencyFromForm(form, &c)
+	if repo.AppConfig.Currencies.IsBase(c.Code) {
+		c.Rate = 1
+	}
+
+	if !form.Valid() {
+		repo.AppConfig.Session.Put(r.Context(), "error", "Check the rate and rounding of "+c.Code)
+		http.Redirect(w, r, "/admin/currencies", http.StatusSeeOther)
+		return
+	}
+
+	err = repo.auditedDB(r).UpdateCurrency(c)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if err := repo.reloadCurrencies(); err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.AppConfig.Session.Put(r.Context(), "flash", "Currency saved")
+	http.Redirect(w, r, "/admin/currencies", http.StatusSeeOther)
+}
+
+// AdminToggleCurrency offers a currency to guests or stops offering it. The base currency is always offered
+func (repo *Repository) AdminToggleCurrency(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	c, err := repo.DB.GetCurrency(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	active := r.URL.Query().Get("active") == "1"
+	if repo.AppConfig.Currencies.IsBase(c.Code) && !active {
+		repo.AppConfig.Session.Put(r.Context(), "error", "The base currency can't be deactivated")
+		http.Redirect(w, r, "/admin/currencies", http.StatusSeeOther)
+		return
+	}
+
+	err = repo.auditedDB(r).SetCurrencyActive(id, active)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if err := repo.reloadCurrencies(); err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if active {
+		repo.AppConfig.Session.Put(r.Context(), "flash", "Currency activated")
+	} else {
+		repo.AppConfig.Session.Put(r.Context(), "flash", "Currency deactivated")
+	}
+	http.Redirect(w, r, "/admin/currencies", http.StatusSeeOther)
+}
+
+// renderCurrencies renders the currencies page
+func (repo *Repository) renderCurrencies(w http.ResponseWriter, r *http.Request, c models.Currency, form *forms.Form) {
+	currencies, err := repo.DB.AllCurrencies()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["currencies"] = currencies
+	data["currency"] = c
+	data["base"] = repo.AppConfig.Currencies.Base().Code
+
+	render.Template(w, r, "admin-currencies.page.gohtml", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
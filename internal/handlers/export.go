@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/chelobotix/booking-go/internal/export"
+	"github.com/chelobotix/booking-go/internal/helpers"
+	"github.com/chelobotix/booking-go/internal/models"
+	"net/http"
+	"strconv"
+)
+
+// AdminExportReservations streams the filtered reservations as a csv or xlsx download
+func (repo *Repository) AdminExportReservations(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseReservationFilter(r.URL.Query())
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = export.FormatCSV
+	}
+
+	contentType, ok := export.ContentTypes[format]
+	if !ok {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="reservations-%s.%s"`, repo.today().Format("20060102"), format))
+
+	writer, err := export.NewWriter(format, w)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = writer.Write([]string{"ID", "First Name", "Last Name", "Email", "Phone", "Room", "Arrival", "Departure", "Status", "Booking", "Created"})
+	if err != nil {
+		repo.AppConfig.ErrorLog.Println(err)
+		return
+	}
+
+	err = repo.DB.StreamReservations(filter, func(res models.Reservation) error {
+		status := models.StatusNew
+		if res.Processed == 1 {
+			status = models.StatusProcessed
+		}
+
+		return writer.Write([]string{
+			strconv.Itoa(res.ID),
+			res.FirstName,
+			res.LastName,
+			res.Email,
+			res.Phone,
+			res.Room.RoomName,
+			res.StartDate.Format("2006-01-02"),
+			res.EndDate.Format("2006-01-02"),
+			status,
+			res.Booking.Confirmation,
+			res.CreatedAt.In(repo.AppConfig.TimeZone).Format("2006-01-02 15:04:05"),
+		})
+	})
+	if err != nil {
+		// headers are already sent at this point, so the download is just cut short
+		repo.AppConfig.ErrorLog.Println(err)
+		return
+	}
+
+	if err := writer.Close(); err != nil {
+		repo.AppConfig.ErrorLog.Println(err)
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"github.com/chelobotix/booking-go/internal/dates"
+	"github.com/chelobotix/booking-go/internal/models"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// filterParams are the query string keys that make up a reservation filter
+var filterParams = []string{"search", "start", "end", "room_id", "status", "sort", "dir"}
+
+// parseReservationFilter reads the reservation filter from query string values
+func parseReservationFilter(q url.Values) (models.ReservationFilter, error) {
+	var filter models.ReservationFilter
+
+	if sd := q.Get("start"); sd != "" {
+		startDate, err := dates.Parse(sd)
+		if err != nil {
+			return filter, err
+		}
+		filter.StartDate = startDate
+	}
+
+	if ed := q.Get("end"); ed != "" {
+		endDate, err := dates.Parse(ed)
+		if err != nil {
+			return filter, err
+		}
+		filter.EndDate = endDate
+	}
+
+	if id := q.Get("room_id"); id != "" {
+		roomId, err := strconv.Atoi(id)
+		if err != nil {
+			return filter, err
+		}
+		filter.RoomID = roomId
+	}
+
+	switch q.Get("status") {
+	case models.StatusNew, models.StatusProcessed:
+		filter.Status = q.Get("status")
+	}
+
+	filter.Search = strings.TrimSpace(q.Get("search"))
+
+	if q.Get("sort") == models.SortCreatedAt {
+		filter.Sort = models.SortCreatedAt
+	} else {
+		filter.Sort = models.SortStartDate
+	}
+	filter.Descending = q.Get("dir") == "desc"
+
+	filter.Page = 1
+	if p := q.Get("page"); p != "" {
+		page, err := strconv.Atoi(p)
+		if err == nil && page > 0 {
+			filter.Page = page
+		}
+	}
+	filter.PerPage = models.DefaultPerPage
+
+	return filter, nil
+}
+
+// paginationData returns the template maps used by the filter form and paging controls,
+// "query" holds the current filters so page links keep them
+func paginationData(q url.Values, filter models.ReservationFilter, total int) (map[string]string, map[string]int) {
+	stringMap := make(map[string]string)
+	kept := url.Values{}
+
+	for _, key := range filterParams {
+		stringMap[key] = q.Get(key)
+		if q.Get(key) != "" {
+			kept.Set(key, q.Get(key))
+		}
+	}
+	stringMap["query"] = kept.Encode()
+
+	pages := (total + filter.PerPage - 1) / filter.PerPage
+	if pages == 0 {
+		pages = 1
+	}
+
+	intMap := make(map[string]int)
+	intMap["page"] = filter.Page
+	intMap["pages"] = pages
+	intMap["total"] = total
+
+	return stringMap, intMap
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"github.com/chelobotix/booking-go/internal/dates"
+	"github.com/chelobotix/booking-go/internal/forms"
+	"github.com/chelobotix/booking-go/internal/helpers"
+	"github.com/chelobotix/booking-go/internal/i18n"
+	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/chelobotix/booking-go/internal/render"
+	"github.com/chelobotix/booking-go/internal/rules"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Flexible search limits
+const (
+	maxFlexibleDays = 7
+	maxMonthNights  = 28
+	windowsPerRoom  = 5
+)
+
+// roomWindows is a room with the stays it is free for
+type roomWindows struct {
+	Room    models.Room
+	Windows []models.AvailableWindow
+}
+
+// flexibleAvailability handles the "± N days" (mode flexible) and "N nights in month X" (mode month)
+// searches, listing per room the free stays nearest to what the guest asked for
+func (repo *Repository) flexibleAvailability(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	adults, children := parseGuests(r)
+
+	today := repo.today()
+
+	var from, to, preferred dates.Date
+	var nights int
+
+	if r.Form.Get("mode") == "month" {
+		form.Required("month", "nights")
+		month, err := dates.ParseMonth(r.Form.Get("month"))
+		if err != nil {
+			form.Errors.Add("month", "Invalid month")
+		}
+		if form.IsInt("nights") {
+			nights, _ = strconv.Atoi(r.Form.Get("nights"))
+			if nights < 1 || nights > maxMonthNights {
+				form.Errors.Add("nights", "Choose between 1 and %d nights", maxMonthNights)
+			}
+		}
+
+		// the whole stay falls in the month, so the last arrival leaves on the first of the next
+		from = month
+		to = month.AddDate(0, 1, -nights)
+		preferred = month
+	} else {
+		form.Required("start", "end", "flex_days")
+		if form.DateRange("start", "end", dates.Layout) && form.IsInt("flex_days") {
+			startDate, _ := dates.Parse(r.Form.Get("start"))
+			endDate, _ := dates.Parse(r.Form.Get("end"))
+
+			days, _ := strconv.Atoi(r.Form.Get("flex_days"))
+			if days < 0 || days > maxFlexibleDays {
+				form.Errors.Add("flex_days", "Choose up to %d days either side", maxFlexibleDays)
+			}
+
+			nights = endDate.Sub(startDate)
+			from = startDate.AddDays(-days)
+			to = startDate.AddDays(days)
+			preferred = startDate
+		}
+	}
+
+	if !form.Valid() {
+		message := i18n.M("Please check the dates of your search")
+		for _, field := range []string{"nights", "flex_days"} {
+			if e := form.Errors.Message(field); e.Key != "" {
+				message = e
+			}
+		}
+		repo.AppConfig.Session.Put(r.Context(), "error", message)
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	if from.Before(today) {
+		from = today
+	}
+
+	var windows []models.AvailableWindow
+	if !to.Before(from) {
+		windows, err = repo.DB.SearchAvailableWindows(from, to, preferred, nights, adults+children)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	bookingRules, err := repo.DB.GetBookingRules()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// the rules go first so rooms still get windowsPerRoom stays when the nearest ones break them
+	var allowed []models.AvailableWindow
+	perRoom := make(map[int]int)
+	for _, window := range windows {
+		if perRoom[window.Room.ID] == windowsPerRoom {
+			continue
+		}
+		if len(rules.Check(bookingRules, window.Room.ID, window.StartDate, window.EndDate, repo.now())) == 0 {
+			allowed = append(allowed, window)
+			perRoom[window.Room.ID]++
+		}
+	}
+	windows = allowed
+
+	if len(windows) == 0 {
+		repo.AppConfig.Session.Put(r.Context(), "error", "No availability")
+		if r.Form.Get("mode") == "month" {
+			http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, waitlistURL(r.Form.Get("start"), r.Form.Get("end"), adults, children), http.StatusSeeOther)
+		return
+	}
+
+	var rooms []roomWindows
+	for _, window := range windows {
+		if len(rooms) == 0 || rooms[len(rooms)-1].Room.ID != window.Room.ID {
+			rooms = append(rooms, roomWindows{Room: window.Room})
+		}
+		rooms[len(rooms)-1].Windows = append(rooms[len(rooms)-1].Windows, window)
+	}
+
+	data := make(map[string]interface{})
+	data["windows"] = rooms
+
+	intMap := make(map[string]int)
+	intMap["adults"] = adults
+	intMap["children"] = children
+
+	render.Template(w, r, "choose-room.page.gohtml", &models.TemplateData{
+		Data:   data,
+		IntMap: intMap,
+	})
+}
+
+// waitlistURL links to the waitlist form prefilled with a search
+func waitlistURL(start, end string, adults, children int) string {
+	waitlist := url.Values{}
+	waitlist.Set("start", start)
+	waitlist.Set("end", end)
+	waitlist.Set("adults", strconv.Itoa(adults))
+	waitlist.Set("children", strconv.Itoa(children))
+
+	return "/waitlist?" + waitlist.Encode()
+}
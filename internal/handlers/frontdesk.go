@@ -0,0 +1,365 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/chelobotix/booking-go/internal/dates"
+	"github.com/chelobotix/booking-go/internal/forms"
+	"github.com/chelobotix/booking-go/internal/helpers"
+	"github.com/chelobotix/booking-go/internal/i18n"
+	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/chelobotix/booking-go/internal/render"
+	"github.com/chelobotix/booking-go/internal/repository"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// arrivalLayout is how the actual arrival time is written in the check-in form
+const arrivalLayout = "2006-01-02T15:04"
+
+// idTypes are the identity documents the front desk accepts at check-in
+var idTypes = []string{"Passport", "National ID card", "Driving licence"}
+
+// AdminFrontDesk lists the guests arriving and leaving on a day, today unless another is asked
+// for, and the guests in house now
+func (repo *Repository) AdminFrontDesk(w http.ResponseWriter, r *http.Request) {
+	day := repo.today()
+	if q := r.URL.Query().Get("date"); q != "" {
+		parsed, err := dates.Parse(q)
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+		day = parsed
+	}
+
+	arrivals, err := repo.DB.ArrivalsOn(day)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	departures, err := repo.DB.DeparturesOn(day)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	inHouse, err := repo.DB.InHouseReservations()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["previous"] = day.AddDays(-1).String()
+	stringMap["next"] = day.AddDays(1).String()
+
+	data := make(map[string]interface{})
+	data["day"] = day
+	data["today"] = repo.today()
+	data["arrivals"] = arrivals
+	data["departures"] = departures
+	data["in_house"] = inHouse
+
+	render.Template(w, r, "admin-front-desk.page.gohtml", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+	})
+}
+
+// frontDeskReservation reads the reservation in the url, answering 404 itself when there is none
+func (repo *Repository) frontDeskReservation(w http.ResponseWriter, r *http.Request) (models.Reservation, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return models.Reservation{}, false
+	}
+
+	res, err := repo.DB.GetReservation(id)
+	if err != nil {
+		helpers.ClientError(w, http.StatusNotFound)
+		return models.Reservation{}, false
+	}
+
+	return res, true
+}
+
+// AdminFrontDeskStay shows a reservation at the front desk: the check-in form before the guest
+// arrives, extending the stay and checking out while they are in house
+func (repo *Repository) AdminFrontDeskStay(w http.ResponseWriter, r *http.Request) {
+	res, ok := repo.frontDeskReservation(w, r)
+	if !ok {
+		return
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["arrived_at"] = repo.now().Format(arrivalLayout)
+	stringMap["end_date"] = res.EndDate.AddDays(1).String()
+
+	repo.renderFrontDeskStay(w, r, res, stringMap, forms.New(nil))
+}
+
+// renderFrontDeskStay renders the front desk page of a reservation
+func (repo *Repository) renderFrontDeskStay(w http.ResponseWriter, r *http.Request, res models.Reservation, stringMap map[string]string, form *forms.Form) {
+	room, err := repo.DB.GetRoomById(res.RoomID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	today := repo.today()
+
+	data := make(map[string]interface{})
+	data["reservation"] = res
+	data["room"] = room
+	data["id_types"] = idTypes
+	data["can_check_in"] = res.CheckedInAt.IsZero() && !res.StartDate.After(today) && res.EndDate.After(today)
+
+	render.Template(w, r, "admin-front-desk-stay.page.gohtml", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		Form:      form,
+	})
+}
+
+// AdminPostCheckIn checks a guest in, recording the identity document seen, when they actually
+// arrived and any notes. Guests can be checked in from their arrival day until they are due to leave
+func (repo *Repository) AdminPostCheckIn(w http.ResponseWriter, r *http.Request) {
+	res, ok := repo.frontDeskReservation(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	back := fmt.Sprintf("/admin/front-desk/%d", res.ID)
+
+	today := repo.today()
+	if !res.CheckedInAt.IsZero() || res.StartDate.After(today) || !res.EndDate.After(today) {
+		repo.AppConfig.Session.Put(r.Context(), "error", "This guest can't be checked in today")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("id_type", "id_number", "arrived_at")
+
+	res.IDType = r.Form.Get("id_type")
+	res.IDNumber = strings.TrimSpace(r.Form.Get("id_number"))
+	res.FrontDeskNotes = strings.TrimSpace(r.Form.Get("notes"))
+
+	if res.IDType != "" {
+		known := false
+		for _, t := range idTypes {
+			if t == res.IDType {
+				known = true
+			}
+		}
+		if !known {
+			form.Errors.Add("id_type", "Choose the document the guest showed")
+		}
+	}
+
+	if form.Get("arrived_at") != "" {
+		res.ArrivedAt, err = time.ParseInLocation(arrivalLayout, form.Get("arrived_at"), repo.AppConfig.TimeZone)
+		if err != nil {
+			form.Errors.Add("arrived_at", "Enter when the guest arrived")
+		} else if res.ArrivedAt.After(repo.now()) {
+			form.Errors.Add("arrived_at", "The arrival time can't be in the future")
+		}
+	}
+
+	if !form.Valid() {
+		stringMap := make(map[string]string)
+		stringMap["arrived_at"] = form.Get("arrived_at")
+		stringMap["end_date"] = res.EndDate.AddDays(1).String()
+
+		repo.renderFrontDeskStay(w, r, res, stringMap, form)
+		return
+	}
+
+	err = repo.auditedDB(r).CheckInReservation(res)
+	if errors.Is(err, repository.ErrStayChanged) {
+		repo.AppConfig.Session.Put(r.Context(), "error", "This guest has already been checked in")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	room, err := repo.DB.GetRoomById(res.RoomID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if !room.Ready() {
+		repo.AppConfig.Session.Put(r.Context(), "warning", i18n.M("%s is not marked clean yet, let housekeeping know", room.RoomName))
+	}
+
+	repo.AppConfig.Session.Put(r.Context(), "flash", i18n.M("%s %s checked in", res.FirstName, res.LastName))
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// AdminPostExtendStay moves the departure of a stay later, after checking the room is still free for
+// the extra nights, which are added to the total
+func (repo *Repository) AdminPostExtendStay(w http.ResponseWriter, r *http.Request) {
+	res, ok := repo.frontDeskReservation(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	back := fmt.Sprintf("/admin/front-desk/%d", res.ID)
+
+	if !res.CheckedOutAt.IsZero() {
+		repo.AppConfig.Session.Put(r.Context(), "error", "This guest has already checked out")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("end_date")
+
+	var endDate dates.Date
+	if form.Get("end_date") != "" && form.IsDate("end_date", dates.Layout) {
+		endDate, _ = dates.Parse(form.Get("end_date"))
+		if !endDate.After(res.EndDate) {
+			form.Errors.Add("end_date", "The new departure must be after the current one")
+		}
+	}
+
+	var extended models.Reservation
+
+	if form.Valid() {
+		extended, err = repo.auditedDB(r).ExtendReservation(res.ID, endDate)
+		if errors.Is(err, repository.ErrNotAvailable) {
+			form.Errors.Add("end_date", "The room is not free for these nights")
+		} else if errors.Is(err, repository.ErrStayChanged) {
+			repo.AppConfig.Session.Put(r.Context(), "error", "This stay was changed meanwhile, check the new departure before extending it")
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		original, err := repo.DB.GetReservation(res.ID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		stringMap := make(map[string]string)
+		stringMap["arrived_at"] = repo.now().Format(arrivalLayout)
+		stringMap["end_date"] = form.Get("end_date")
+
+		repo.renderFrontDeskStay(w, r, original, stringMap, form)
+		return
+	}
+
+	repo.AppConfig.Session.Put(r.Context(), "flash", i18n.M("Stay extended to %s, the new total is %s", extended.EndDate.Format("January 2, 2006"), render.Money(extended.Total)))
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// AdminPostCheckOut checks a guest out, settling what they still owe by card or in cash, and leaves
+// their room dirty for housekeeping
+func (repo *Repository) AdminPostCheckOut(w http.ResponseWriter, r *http.Request) {
+	res, ok := repo.frontDeskReservation(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	back := fmt.Sprintf("/admin/front-desk/%d", res.ID)
+
+	if !res.InHouse() {
+		repo.AppConfig.Session.Put(r.Context(), "error", "Only guests in house can be checked out")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+
+	var settlement []models.Payment
+	balance := res.Balance()
+
+	if balance > 0 {
+		switch form.Get("method") {
+		case "card":
+			checkCard(form, repo.now())
+			if form.Valid() {
+				settlement, err = repo.chargeCard(form, balance, res.Currency,
+					fmt.Sprintf("Balance for %s from %s", res.Room.RoomName, res.StartDate.Format("2006-01-02")), "Balance at check-out")
+				if err != nil {
+					helpers.ServerError(w, err)
+					return
+				}
+			}
+		case "cash":
+			settlement = []models.Payment{{
+				Kind:        models.PaymentCharge,
+				Amount:      balance,
+				Description: "Balance paid in cash at check-out",
+			}}
+		default:
+			form.Errors.Add("method", "Choose how the guest pays the balance")
+		}
+	}
+
+	if !form.Valid() {
+		stringMap := make(map[string]string)
+		stringMap["arrived_at"] = repo.now().Format(arrivalLayout)
+		stringMap["end_date"] = res.EndDate.AddDays(1).String()
+
+		repo.renderFrontDeskStay(w, r, res, stringMap, form)
+		return
+	}
+
+	var payment models.Payment
+	if len(settlement) > 0 {
+		payment = settlement[0]
+	}
+
+	err = repo.auditedDB(r).CheckOutReservation(res.ID, payment)
+	if err != nil {
+		if payment.Reference != "" {
+			repo.voidPayments(settlement, res.Currency)
+		}
+		if errors.Is(err, repository.ErrStayChanged) {
+			// someone else checked the guest out meanwhile, the card charge above was voided
+			repo.AppConfig.Session.Put(r.Context(), "error", "This guest has already been checked out")
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		}
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if balance < 0 {
+		repo.AppConfig.Session.Put(r.Context(), "warning", i18n.M("The guest paid %s more than the total", render.Money(-balance)))
+	}
+
+	repo.AppConfig.Session.Put(r.Context(), "flash", i18n.M("%s %s checked out", res.FirstName, res.LastName))
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
@@ -0,0 +1,403 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/chelobotix/booking-go/internal/currency"
+	"github.com/chelobotix/booking-go/internal/forms"
+	"github.com/chelobotix/booking-go/internal/helpers"
+	"github.com/chelobotix/booking-go/internal/i18n"
+	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/chelobotix/booking-go/internal/payments"
+	"github.com/chelobotix/booking-go/internal/pricing"
+	"github.com/chelobotix/booking-go/internal/render"
+	"github.com/chelobotix/booking-go/internal/repository"
+	"github.com/chelobotix/booking-go/internal/rules"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// group returns the rooms the guest has collected for a group booking
+func (repo *Repository) group(r *http.Request) []models.Reservation {
+	group, _ := repo.AppConfig.Session.Get(r.Context(), "group").([]models.Reservation)
+	return group
+}
+
+// AddRoomToGroup adds the chosen room, for the dates last searched and the adults and children
+// staying in it, to the guest's group booking
+func (repo *Repository) AddRoomToGroup(w http.ResponseWriter, r *http.Request) {
+	roomId, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	res, ok := repo.AppConfig.Session.Get(r.Context(), "reservation").(models.Reservation)
+	if !ok {
+		repo.AppConfig.Session.Put(r.Context(), "error", "Search for dates first")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	room, err := repo.DB.GetRoomById(roomId)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	res.Adults, res.Children = parseGuests(r)
+	if res.Adults+res.Children > room.MaxOccupancy {
+		repo.AppConfig.Session.Put(r.Context(), "error", i18n.M("This room sleeps at most %d guests", room.MaxOccupancy))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	res.RoomID = roomId
+	res.Room = room
+
+	group := repo.group(r)
+	for _, other := range group {
+		if other.RoomID == res.RoomID && res.StartDate.Before(other.EndDate) && res.EndDate.After(other.StartDate) {
+			repo.AppConfig.Session.Put(r.Context(), "error", "That room is already in your booking for these dates")
+			http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+			return
+		}
+	}
+
+	// the hold belongs to this group entry, not to the searched reservation
+	res.HoldID = 0
+	err = repo.holdRoom(&res)
+	if errors.Is(err, repository.ErrNotAvailable) {
+		repo.AppConfig.Session.Put(r.Context(), "error", i18n.M("Sorry, %s was just taken for these dates", room.RoomName))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	group = append(group, res)
+	repo.AppConfig.Session.Put(r.Context(), "group", group)
+
+	repo.AppConfig.Session.Put(r.Context(), "flash", i18n.M("%s added to your booking", room.RoomName))
+	http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+}
+
+// BookCombination adds every room of a suggested combination to the guest's group booking,
+// with the searched party spread over them
+func (repo *Repository) BookCombination(w http.ResponseWriter, r *http.Request) {
+	res, ok := repo.AppConfig.Session.Get(r.Context(), "reservation").(models.Reservation)
+	if !ok {
+		repo.AppConfig.Session.Put(r.Context(), "error", "Search for dates first")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	var rooms []models.Room
+	for _, id := range strings.Split(r.URL.Query().Get("rooms"), ",") {
+		roomId, err := strconv.Atoi(id)
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		room, err := repo.DB.GetRoomById(roomId)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		rooms = append(rooms, room)
+	}
+
+	res.HoldID = 0
+	combination, fits := distributeGuests(res, rooms)
+	if !fits {
+		repo.AppConfig.Session.Put(r.Context(), "error", "These rooms can't sleep your whole party")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	for i := range combination {
+		err := repo.holdRoom(&combination[i])
+		if err == nil {
+			continue
+		}
+
+		for _, held := range combination[:i] {
+			repo.releaseHold(held)
+		}
+		if errors.Is(err, repository.ErrNotAvailable) {
+			repo.AppConfig.Session.Put(r.Context(), "error", i18n.M("Sorry, %s was just taken for these dates", combination[i].Room.RoomName))
+			http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+			return
+		}
+		helpers.ServerError(w, err)
+		return
+	}
+
+	group := append(repo.group(r), combination...)
+	repo.AppConfig.Session.Put(r.Context(), "group", group)
+
+	http.Redirect(w, r, "/make-group-reservation", http.StatusSeeOther)
+}
+
+// RemoveRoomFromGroup drops one room from the guest's group booking
+func (repo *Repository) RemoveRoomFromGroup(w http.ResponseWriter, r *http.Request) {
+	index, err := strconv.Atoi(chi.URLParam(r, "index"))
+	group := repo.group(r)
+
+	if err != nil || index < 0 || index >= len(group) {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	repo.releaseHold(group[index])
+	group = append(group[:index], group[index+1:]...)
+	repo.AppConfig.Session.Put(r.Context(), "group", group)
+
+	http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+}
+
+// GroupReservation shows the guest details form for a group booking
+func (repo *Repository) GroupReservation(w http.ResponseWriter, r *http.Request) {
+	group := repo.group(r)
+	if len(group) == 0 {
+		repo.AppConfig.Session.Put(r.Context(), "error", "Add at least one room first")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	err := repo.priceGroup(group)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var guest models.Reservation
+	err = repo.prefillGuest(r, &guest)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.renderGroupReservation(w, r, group, guest, forms.New(nil))
+}
+
+// priceGroup prices every reservation in the group at its room's current rate and attaches its cancellation policy
+func (repo *Repository) priceGroup(group []models.Reservation) error {
+	for i := range group {
+		room, err := repo.DB.GetRoomById(group[i].RoomID)
+		if err != nil {
+			return err
+		}
+		pricing.Apply(&group[i], room, nil)
+
+		if err := repo.attachPolicy(&group[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupDeposits returns the deposit due on each reservation of the group and their sum
+func (repo *Repository) groupDeposits(group []models.Reservation) ([]int, int) {
+	deposits := make([]int, len(group))
+	var total int
+	for i, res := range group {
+		deposits[i] = payments.Deposit(res.Total, repo.AppConfig.DepositPercent)
+		total += deposits[i]
+	}
+	return deposits, total
+}
+
+// renderGroupReservation renders the guest details form for a group booking
+func (repo *Repository) renderGroupReservation(w http.ResponseWriter, r *http.Request, group []models.Reservation, guest models.Reservation, form *forms.Form) {
+	var total int
+	for _, res := range group {
+		total += res.Total
+	}
+	_, deposit := repo.groupDeposits(group)
+
+	data := make(map[string]interface{})
+	data["group"] = group
+	data["reservation"] = guest
+
+	intMap := make(map[string]int)
+	intMap["total"] = total
+	intMap["deposit"] = deposit
+
+	render.Template(w, r, "make-group-reservation.page.gohtml", &models.TemplateData{
+		Form:   form,
+		Data:   data,
+		IntMap: intMap,
+	})
+}
+
+// PostGroupReservation books every room in the group under one confirmation number
+func (repo *Repository) PostGroupReservation(w http.ResponseWriter, r *http.Request) {
+	group := repo.group(r)
+	if len(group) == 0 {
+		repo.AppConfig.Session.Put(r.Context(), "error", "Add at least one room first")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	guest := models.Reservation{
+		FirstName: r.Form.Get("first_name"),
+		LastName:  r.Form.Get("last_name"),
+		Email:     r.Form.Get("email"),
+		Phone:     r.Form.Get("phone"),
+	}
+
+	form := forms.New(r.PostForm)
+
+	form.Required("first_name", "last_name", "email", "phone")
+	form.MinLength("first_name", 3)
+	form.IsEmail("email")
+
+	bookingRules, err := repo.DB.GetBookingRules()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	for _, res := range group {
+		for _, v := range rules.Check(bookingRules, res.RoomID, res.StartDate, res.EndDate, repo.now()) {
+			form.Errors.Add("group", "%s: %s", res.Room.RoomName, v.Message)
+		}
+	}
+
+	err = repo.priceGroup(group)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	checkCard(form, repo.now())
+
+	// the whole group is charged in the currency the guest is looking at, at today's rate
+	cur := render.DisplayCurrency(r)
+	for i := range group {
+		group[i].Currency = cur
+	}
+
+	// one charge covers the deposits of every room, recorded on each reservation for its share
+	var charge []models.Payment
+	deposits, deposit := repo.groupDeposits(group)
+	if form.Valid() {
+		charge, err = repo.chargeDeposit(form, deposit, cur, fmt.Sprintf("Deposit for %d rooms", len(group)))
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		repo.renderGroupReservation(w, r, group, guest, form)
+		return
+	}
+
+	for i := range group {
+		group[i].FirstName = guest.FirstName
+		group[i].LastName = guest.LastName
+		group[i].Email = guest.Email
+		group[i].Phone = guest.Phone
+
+		group[i].Payments = nil
+		group[i].Paid = 0
+		for _, p := range charge {
+			if deposits[i] > 0 {
+				p.Amount = deposits[i]
+				group[i].Payments = append(group[i].Payments, p)
+				group[i].Paid += p.Amount
+			}
+		}
+	}
+
+	booking, err := repo.auditedDB(r).InsertBooking(group)
+	if err != nil {
+		repo.voidPayments(charge, cur)
+	}
+	if errors.Is(err, repository.ErrNotAvailable) {
+		repo.AppConfig.Session.Put(r.Context(), "error", "One of the rooms is no longer available, please review your booking")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	t, date := repo.translator(locale(r))
+
+	var lines []string
+	for _, res := range group {
+		lines = append(lines, t("%s from %s to %s, %s. Cancellation: %s", res.Room.RoomName, date(res.StartDate), date(res.EndDate),
+			currency.Price(res.Total, cur), policyText(t, res.CancellationPolicy))+" "+
+			t("Check-in is from %s and check-out is by %s.", res.Room.CheckInTime, res.Room.CheckOutTime))
+	}
+
+	htmlMessage := fmt.Sprintf(`
+		<strong>%s %s</strong><br>
+		%s <br>
+		%s<br>
+		%s<br>
+		%s: %s
+	`, t("Reservation Confirmation"), booking.Confirmation, t("Dear %s,", guest.FirstName),
+		t("This is a confirmation for your reservation of:"), strings.Join(lines, "<br>"), t("Paid now"), currency.Price(deposit, cur))
+
+	var reservationIds []int
+	booked, err := repo.DB.GetBookingReservations(booking.ID)
+	if err != nil {
+		repo.AppConfig.ErrorLog.Println(err)
+	}
+	for _, res := range booked {
+		reservationIds = append(reservationIds, res.ID)
+	}
+
+	repo.AppConfig.MailChan <- models.MailData{
+		To:          guest.Email,
+		From:        "me@gmail.com",
+		Subject:     t("Reservation Confirmation") + " " + booking.Confirmation,
+		Content:     htmlMessage,
+		Template:    "basic.html",
+		Attachments: repo.invoiceAttachments(reservationIds...),
+	}
+
+	repo.rememberGuest(r, guest.Email)
+	repo.AppConfig.Session.Remove(r.Context(), "group")
+	repo.AppConfig.Session.Put(r.Context(), "booking", booking)
+	repo.AppConfig.Session.Put(r.Context(), "booking_rooms", group)
+
+	http.Redirect(w, r, "/group-reservation-summary", http.StatusSeeOther)
+}
+
+// GroupReservationSummary shows the booking that was just made
+func (repo *Repository) GroupReservationSummary(w http.ResponseWriter, r *http.Request) {
+	booking, ok := repo.AppConfig.Session.Get(r.Context(), "booking").(models.Booking)
+	if !ok {
+		repo.AppConfig.Session.Put(r.Context(), "error", "cannot get booking from session")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+	group, _ := repo.AppConfig.Session.Get(r.Context(), "booking_rooms").([]models.Reservation)
+
+	repo.AppConfig.Session.Remove(r.Context(), "booking")
+	repo.AppConfig.Session.Remove(r.Context(), "booking_rooms")
+
+	data := make(map[string]interface{})
+	data["booking"] = booking
+	data["group"] = group
+
+	render.Template(w, r, "group-reservation-summary.page.gohtml", &models.TemplateData{
+		Data: data,
+	})
+}
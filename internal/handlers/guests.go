@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"github.com/chelobotix/booking-go/internal/models"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// parseGuests reads the adults and children counts from a search form,
+// a search is always for at least one adult
+func parseGuests(r *http.Request) (int, int) {
+	adults, err := strconv.Atoi(r.FormValue("adults"))
+	if err != nil || adults < 1 {
+		adults = 1
+	}
+
+	children, err := strconv.Atoi(r.FormValue("children"))
+	if err != nil || children < 0 {
+		children = 0
+	}
+
+	return adults, children
+}
+
+// suggestRooms picks the fewest free rooms that together sleep guests people,
+// or nil when even all of them are not enough
+func suggestRooms(rooms []models.Room, guests int) []models.Room {
+	free := make([]models.Room, len(rooms))
+	copy(free, rooms)
+	sort.Slice(free, func(i, j int) bool {
+		return free[i].MaxOccupancy > free[j].MaxOccupancy
+	})
+
+	var picked []models.Room
+	remaining := guests
+
+	for remaining > 0 && len(free) > 0 {
+		// the smallest room that fits everyone left finishes the combination
+		fit := -1
+		for i, room := range free {
+			if room.MaxOccupancy >= remaining {
+				fit = i
+			}
+		}
+
+		if fit >= 0 {
+			picked = append(picked, free[fit])
+			return picked
+		}
+
+		picked = append(picked, free[0])
+		remaining -= free[0].MaxOccupancy
+		free = free[1:]
+	}
+
+	if remaining > 0 {
+		return nil
+	}
+
+	return picked
+}
+
+// distributeGuests spreads the party over the rooms of a combination, adults first, and reports
+// false when the rooms can't sleep everyone
+func distributeGuests(res models.Reservation, rooms []models.Room) ([]models.Reservation, bool) {
+	var reservations []models.Reservation
+	adults, children := res.Adults, res.Children
+
+	for _, room := range rooms {
+		item := res
+		item.RoomID = room.ID
+		item.Room = room
+
+		item.Adults = min(adults, room.MaxOccupancy)
+		adults -= item.Adults
+
+		item.Children = min(children, room.MaxOccupancy-item.Adults)
+		children -= item.Children
+
+		reservations = append(reservations, item)
+	}
+
+	if adults > 0 || children > 0 {
+		return nil, false
+	}
+
+	return reservations, true
+}
@@ -5,13 +5,19 @@ import (
 	"errors"
 	"fmt"
 	"github.com/chelobotix/booking-go/internal/config"
+	"github.com/chelobotix/booking-go/internal/currency"
+	"github.com/chelobotix/booking-go/internal/dates"
 	"github.com/chelobotix/booking-go/internal/driver"
 	"github.com/chelobotix/booking-go/internal/forms"
 	"github.com/chelobotix/booking-go/internal/helpers"
+	"github.com/chelobotix/booking-go/internal/i18n"
 	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/chelobotix/booking-go/internal/payments"
+	"github.com/chelobotix/booking-go/internal/pricing"
 	"github.com/chelobotix/booking-go/internal/render"
 	"github.com/chelobotix/booking-go/internal/repository"
 	"github.com/chelobotix/booking-go/internal/repository/dbrepo"
+	"github.com/chelobotix/booking-go/internal/rules"
 	"github.com/go-chi/chi/v5"
 	"log"
 	"net/http"
@@ -70,9 +76,23 @@ func (repo *Repository) Reservations(w http.ResponseWriter, r *http.Request) {
 	room, err := repo.DB.GetRoomById(res.RoomID)
 	if err != nil {
 		helpers.ServerError(w, err)
+		return
 	}
 
-	res.Room.RoomName = room.RoomName
+	res.Room = room
+	pricing.Apply(&res, room, nil)
+
+	err = repo.attachPolicy(&res)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = repo.prefillGuest(r, &res)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
 
 	repo.AppConfig.Session.Put(r.Context(), "reservation", res)
 
@@ -87,10 +107,14 @@ func (repo *Repository) Reservations(w http.ResponseWriter, r *http.Request) {
 
 	data["reservation"] = res
 
+	intMap := make(map[string]int)
+	intMap["deposit"] = payments.Deposit(res.Total, repo.AppConfig.DepositPercent)
+
 	render.Template(w, r, "make-reservation.page.gohtml", &models.TemplateData{
 		Form:      forms.New(nil),
 		Data:      data,
 		StringMap: stringMap,
+		IntMap:    intMap,
 	})
 }
 
@@ -120,53 +144,110 @@ func (repo *Repository) PostReservations(w http.ResponseWriter, r *http.Request)
 	form.MinLength("first_name", 3)
 	form.IsEmail("email")
 
+	bookingRules, err := repo.DB.GetBookingRules()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	addViolations(form, rules.Check(bookingRules, reservation.RoomID, reservation.StartDate, reservation.EndDate, repo.now()), "start_date", "end_date")
+
+	err = repo.priceReservation(form, &reservation)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	checkCard(form, repo.now())
+
+	// the guest is charged in the currency they are looking at, at today's rate
+	reservation.Currency = render.DisplayCurrency(r)
+
+	if form.Valid() {
+		reservation.Payments, err = repo.chargeDeposit(form, payments.Deposit(reservation.Total, repo.AppConfig.DepositPercent), reservation.Currency,
+			fmt.Sprintf("Deposit for %s from %s", reservation.Room.RoomName, reservation.StartDate.Format("2006-01-02")))
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
 	if !form.Valid() {
+		stringMap := make(map[string]string)
+		stringMap["start_date"] = reservation.StartDate.Format("2006-01-02")
+		stringMap["end_date"] = reservation.EndDate.Format("2006-01-02")
+
 		data := make(map[string]interface{})
 		data["reservation"] = reservation
+
+		intMap := make(map[string]int)
+		intMap["deposit"] = payments.Deposit(reservation.Total, repo.AppConfig.DepositPercent)
+
 		render.Template(w, r, "make-reservation.page.gohtml", &models.TemplateData{
-			Form: form,
-			Data: data,
+			Form:      form,
+			Data:      data,
+			StringMap: stringMap,
+			IntMap:    intMap,
 		})
 		return
 	}
 
-	newReservationId, err := repo.DB.InsertReservation(reservation)
+	reservationId, err := repo.auditedDB(r).ConfirmReservation(reservation)
 	if err != nil {
-		helpers.ServerError(w, err)
+		repo.voidPayments(reservation.Payments, reservation.Currency)
+		reservation.Payments = nil
+	}
+	if errors.Is(err, repository.ErrNotAvailable) {
+		repo.AppConfig.Session.Remove(r.Context(), "reservation")
+		repo.AppConfig.Session.Put(r.Context(), "error", "Sorry, the room was booked by someone else while your hold expired")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
 		return
 	}
-
-	restriction := models.RoomRestriction{
-		StartDate:     reservation.StartDate,
-		EndDate:       reservation.EndDate,
-		RoomID:        reservation.RoomID,
-		ReservationID: newReservationId,
-		RestrictionID: 1,
+	if errors.Is(err, repository.ErrPromoUnavailable) {
+		repo.AppConfig.Session.Put(r.Context(), "reservation", reservation)
+		repo.AppConfig.Session.Put(r.Context(), "error", "Sorry, that promo code has just been used up")
+		http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
+		return
 	}
-
-	err = repo.DB.InsertRoomRestriction(restriction)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
-	// send notification to guest
+	for _, p := range reservation.Payments {
+		reservation.Paid += p.Amount
+	}
+
+	// send notification to guest in the language they booked in
+	t, date := repo.translator(locale(r))
+
 	htmlMessage := fmt.Sprintf(`
-		<strong>Reservatiuon Confirmation</strong>
-		Dear %s:, <br>
-		This is a confirmation for your reservation of room %s from %s to %s.
-	`, reservation.FirstName, reservation.Room.RoomName, reservation.StartDate.Format("206-01-02"), reservation.EndDate.Format("206-01-02"))
+		<strong>%s</strong><br>
+		%s <br>
+		%s<br>
+		%s<br>
+		%s: %s<br>
+		%s: %s, %s: %s<br>
+		%s: %s
+	`, t("Reservation Confirmation"), t("Dear %s,", reservation.FirstName),
+		t("This is a confirmation for your reservation of room %s from %s to %s.", reservation.Room.RoomName, date(reservation.StartDate), date(reservation.EndDate)),
+		t("Check-in is from %s and check-out is by %s.", reservation.Room.CheckInTime, reservation.Room.CheckOutTime),
+		t("Total"), currency.Price(reservation.Total, reservation.Currency),
+		t("Paid now"), currency.Price(reservation.Paid, reservation.Currency),
+		t("due on arrival"), currency.Price(reservation.Balance(), reservation.Currency),
+		t("Cancellation"), policyText(t, reservation.CancellationPolicy))
 
 	msg := models.MailData{
-		To:       reservation.Email,
-		From:     "me@gmail.com",
-		Subject:  "Reservation Confirmation",
-		Content:  htmlMessage,
-		Template: "basic.html",
+		To:          reservation.Email,
+		From:        "me@gmail.com",
+		Subject:     t("Reservation Confirmation"),
+		Content:     htmlMessage,
+		Template:    "basic.html",
+		Attachments: repo.invoiceAttachments(reservationId),
 	}
 
 	repo.AppConfig.MailChan <- msg
 
+	repo.rememberGuest(r, reservation.Email)
 	repo.AppConfig.Session.Put(r.Context(), "reservation", reservation)
 
 	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
@@ -186,15 +267,8 @@ func (repo *Repository) ReservationSummary(w http.ResponseWriter, r *http.Reques
 	data := make(map[string]interface{})
 	data["reservation"] = reservation
 
-	sd := reservation.StartDate.Format("2006-01-02")
-	ed := reservation.EndDate.Format("2006-01-02")
-	stringMap := make(map[string]string)
-	stringMap["start_date"] = sd
-	stringMap["end_date"] = ed
-
 	render.Template(w, r, "reservation-summary.page.gohtml", &models.TemplateData{
-		Data:      data,
-		StringMap: stringMap,
+		Data: data,
 	})
 }
 
@@ -206,42 +280,111 @@ func (repo *Repository) Major(w http.ResponseWriter, r *http.Request) {
 
 // Availability is the handler for the home page
 func (repo *Repository) Availability(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "search-availability.page.gohtml", &models.TemplateData{})
+	repo.renderSearch(w, r, forms.New(nil))
+}
+
+// renderSearch renders the availability search form
+func (repo *Repository) renderSearch(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	data := make(map[string]interface{})
+	data["group"] = repo.group(r)
+
+	intMap := make(map[string]int)
+	intMap["max_flexible_days"] = maxFlexibleDays
+	intMap["max_month_nights"] = maxMonthNights
+
+	render.Template(w, r, "search-availability.page.gohtml", &models.TemplateData{
+		Data:   data,
+		IntMap: intMap,
+		Form:   form,
+	})
 }
 
 // PostAvailability is the handler for the home page
 func (repo *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if mode := r.Form.Get("mode"); mode == "flexible" || mode == "month" {
+		repo.flexibleAvailability(w, r)
+		return
+	}
+
 	start := r.Form.Get("start")
 	end := r.Form.Get("end")
 
-	layout := "2006-01-02"
-	startDate, err := time.Parse(layout, start)
-	if err != nil {
-		helpers.ServerError(w, err)
+	form := forms.New(r.PostForm)
+	form.Required("start", "end")
+	if !form.DateRange("start", "end", dates.Layout) {
+		repo.renderSearch(w, r, form)
+		return
 	}
-	endDate, err := time.Parse(layout, end)
+
+	startDate, _ := dates.Parse(start)
+	endDate, _ := dates.Parse(end)
+
+	bookingRules, err := repo.DB.GetBookingRules()
 	if err != nil {
 		helpers.ServerError(w, err)
+		return
 	}
 
-	availableRooms, err := repo.DB.SearchAvailabilityForAllRooms(startDate, endDate)
-	if err != nil {
-		helpers.ServerError(w, err)
+	// rules for every room are reported on the form, rules for single rooms only narrow the results
+	addViolations(form, rules.Check(bookingRules, 0, startDate, endDate, repo.now()), "start", "end")
+	if !form.Valid() {
+		repo.renderSearch(w, r, form)
 		return
 	}
 
-	if len(availableRooms) == 0 {
-		repo.AppConfig.Session.Put(r.Context(), "error", "No availability")
-		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+	adults, children := parseGuests(r)
+
+	availableRooms, err := repo.DB.SearchAvailabilityForAllRooms(startDate, endDate, adults+children)
+	if err != nil {
+		helpers.ServerError(w, err)
 		return
 	}
+	availableRooms, violations := allowedRooms(bookingRules, availableRooms, startDate, endDate, repo.now())
 
 	data := make(map[string]interface{})
 	data["availableRooms"] = availableRooms
 
+	if len(availableRooms) == 0 {
+		// no single room is big enough, see whether several free rooms together are
+		freeRooms, err := repo.DB.SearchAvailabilityForAllRooms(startDate, endDate, 0)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		freeRooms, broken := allowedRooms(bookingRules, freeRooms, startDate, endDate, repo.now())
+		violations = append(violations, broken...)
+
+		combination := suggestRooms(freeRooms, adults+children)
+		if combination == nil {
+			// rooms are free but their rules forbid the stay, say why rather than offering the waitlist
+			if len(violations) > 0 {
+				addViolations(form, violations, "start", "end")
+				repo.renderSearch(w, r, form)
+				return
+			}
+
+			repo.AppConfig.Session.Put(r.Context(), "error", "No availability")
+			http.Redirect(w, r, waitlistURL(start, end, adults, children), http.StatusSeeOther)
+			return
+		}
+
+		data["combination"] = combination
+	}
+
+	// a new search starts over, so the room held from a previous one is let go
+	repo.releaseSessionHold(r)
+
 	res := models.Reservation{
 		StartDate: startDate,
 		EndDate:   endDate,
+		Adults:    adults,
+		Children:  children,
 	}
 
 	repo.AppConfig.Session.Put(r.Context(), "reservation", res)
@@ -257,6 +400,8 @@ type jsonResponse struct {
 	RoomID    string `json:"room_id"`
 	StartDate string `json:"start_date"`
 	EndDate   string `json:"end_date"`
+	Adults    int    `json:"adults"`
+	Children  int    `json:"children"`
 }
 
 // AvailabilityJSON is the handler for the home page
@@ -264,28 +409,56 @@ func (repo *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request)
 	sd := r.Form.Get("start")
 	ed := r.Form.Get("end")
 
-	layout := "2006-01-02"
-
-	startDate, err := time.Parse(layout, sd)
+	startDate, err := dates.Parse(sd)
 	if err != nil {
 		helpers.ServerError(w, err)
 	}
 
-	endDate, err := time.Parse(layout, ed)
+	endDate, err := dates.Parse(ed)
 	if err != nil {
 		helpers.ServerError(w, err)
 	}
 
 	roomId, _ := strconv.Atoi(r.Form.Get("room_id"))
+	adults, children := parseGuests(r)
 
 	available, _ := repo.DB.SearchAvailabilityByDateByRoomId(startDate, endDate, roomId)
 
+	var message i18n.Message
+	if available {
+		room, err := repo.DB.GetRoomById(roomId)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		if adults+children > room.MaxOccupancy {
+			available = false
+			message = i18n.M("This room sleeps at most %d guests", room.MaxOccupancy)
+		}
+	}
+
+	if available {
+		bookingRules, err := repo.DB.GetBookingRules()
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		if violations := rules.Check(bookingRules, roomId, startDate, endDate, repo.now()); len(violations) > 0 {
+			available = false
+			message = violations[0].Message
+		}
+	}
+
 	response := jsonResponse{
 		Ok:        available,
-		Message:   "",
+		Message:   repo.AppConfig.Translations.Message(locale(r), message),
 		StartDate: sd,
 		EndDate:   ed,
 		RoomID:    strconv.Itoa(roomId),
+		Adults:    adults,
+		Children:  children,
 	}
 
 	outResponse, err := json.MarshalIndent(response, "", "")
@@ -317,6 +490,18 @@ func (repo *Repository) ChooseRoom(w http.ResponseWriter, r *http.Request) {
 
 	res.RoomID = roomId
 
+	err = repo.holdRoom(&res)
+	if errors.Is(err, repository.ErrNotAvailable) {
+		repo.AppConfig.Session.Put(r.Context(), "reservation", res)
+		repo.AppConfig.Session.Put(r.Context(), "error", "Sorry, that room was just taken, please choose another")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
 	repo.AppConfig.Session.Put(r.Context(), "reservation", res)
 
 	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
@@ -329,14 +514,12 @@ func (repo *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 	sd := r.URL.Query().Get("s")
 	ed := r.URL.Query().Get("e")
 
-	layout := "2006-01-02"
-
-	startDate, err := time.Parse(layout, sd)
+	startDate, err := dates.Parse(sd)
 	if err != nil {
 		helpers.ServerError(w, err)
 	}
 
-	endDate, err := time.Parse(layout, ed)
+	endDate, err := dates.Parse(ed)
 	if err != nil {
 		helpers.ServerError(w, err)
 	}
@@ -350,6 +533,33 @@ func (repo *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 	res.StartDate = startDate
 	res.EndDate = endDate
 	res.Room.RoomName = room.RoomName
+	res.Adults, res.Children = parseGuests(r)
+
+	bookingRules, err := repo.DB.GetBookingRules()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if violations := rules.Check(bookingRules, roomId, startDate, endDate, repo.now()); len(violations) > 0 {
+		repo.AppConfig.Session.Put(r.Context(), "error", violations[0].Message)
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	repo.releaseSessionHold(r)
+
+	err = repo.holdRoom(&res)
+	if errors.Is(err, repository.ErrNotAvailable) {
+		repo.AppConfig.Session.Remove(r.Context(), "reservation")
+		repo.AppConfig.Session.Put(r.Context(), "error", "Sorry, that room was just taken for these dates")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
 
 	repo.AppConfig.Session.Put(r.Context(), "reservation", res)
 
@@ -408,7 +618,19 @@ func (repo *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
 }
 
 func (repo *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request) {
-	reservations, err := repo.DB.AllNewReservations()
+	filter, err := parseReservationFilter(r.URL.Query())
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	reservations, total, err := repo.DB.AllNewReservations(filter)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := repo.DB.GetAllRooms()
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
@@ -416,14 +638,32 @@ func (repo *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Requ
 
 	data := make(map[string]interface{})
 	data["reservations"] = reservations
+	data["rooms"] = rooms
 
-	render.Template(w, r, "admin-all-reservations.page.gohtml", &models.TemplateData{
-		Data: data,
+	stringMap, intMap := paginationData(r.URL.Query(), filter, total)
+	stringMap["src"] = "new"
+
+	render.Template(w, r, "admin-new-reservations.page.gohtml", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+		IntMap:    intMap,
 	})
 }
 
 func (repo *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) {
-	reservations, err := repo.DB.AllReservations()
+	filter, err := parseReservationFilter(r.URL.Query())
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	reservations, total, err := repo.DB.AllReservations(filter)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := repo.DB.GetAllRooms()
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
@@ -431,14 +671,20 @@ func (repo *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Requ
 
 	data := make(map[string]interface{})
 	data["reservations"] = reservations
+	data["rooms"] = rooms
+
+	stringMap, intMap := paginationData(r.URL.Query(), filter, total)
+	stringMap["src"] = "all"
 
 	render.Template(w, r, "admin-all-reservations.page.gohtml", &models.TemplateData{
-		Data: data,
+		Data:      data,
+		StringMap: stringMap,
+		IntMap:    intMap,
 	})
 }
 
 func (repo *Repository) AdminCalendarReservations(w http.ResponseWriter, r *http.Request) {
-	now := time.Now()
+	now := repo.today().FirstOfMonth()
 
 	if r.URL.Query().Get("y") != "" && r.URL.Query().Get("m") != "" {
 		year, err := strconv.Atoi(r.URL.Query().Get("y"))
@@ -452,7 +698,7 @@ func (repo *Repository) AdminCalendarReservations(w http.ResponseWriter, r *http
 			return
 		}
 
-		now = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+		now = dates.New(year, time.Month(month), 1)
 	}
 
 	data := make(map[string]interface{})
@@ -476,13 +722,11 @@ func (repo *Repository) AdminCalendarReservations(w http.ResponseWriter, r *http
 	stringMap["this_month_year"] = now.Format("2006")
 
 	//getting first and last day
-	currentYear, currentMonth, _ := now.Date()
-	currentLocation := now.Location()
-	firstOfMonth := time.Date(currentYear, currentMonth, 1, 0, 0, 0, 0, currentLocation)
+	firstOfMonth := now
 	lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
 
 	intMap := make(map[string]int)
-	intMap["days_in_month"] = lastOfMonth.Day()
+	intMap["days_in_month"] = lastOfMonth.Day
 
 	rooms, err := repo.DB.GetAllRooms()
 	if err != nil {
@@ -496,9 +740,9 @@ func (repo *Repository) AdminCalendarReservations(w http.ResponseWriter, r *http
 		reservationMap := make(map[string]int)
 		blockMap := make(map[string]int)
 
-		for d := firstOfMonth; d.After(lastOfMonth) == false; d = d.AddDate(0, 0, 1) {
-			reservationMap[d.Format("2006-01-02")] = 0
-			blockMap[d.Format("2006-01-02")] = 0
+		for d := firstOfMonth; d.After(lastOfMonth) == false; d = d.AddDays(1) {
+			reservationMap[d.String()] = 0
+			blockMap[d.String()] = 0
 		}
 
 		restrictions, err := repo.DB.GetRestrictionsForRoomByDate(room.ID, firstOfMonth, lastOfMonth)
@@ -508,12 +752,16 @@ func (repo *Repository) AdminCalendarReservations(w http.ResponseWriter, r *http
 		}
 
 		for _, r := range restrictions {
+			if r.RestrictionID == models.RestrictionHold || r.RestrictionID == models.RestrictionCleaning {
+				continue
+			}
+
 			if r.ReservationID > 0 {
-				for d := r.StartDate; d.After(r.EndDate) == false; d = d.AddDate(0, 0, 1) {
-					reservationMap[d.Format("2006-01-02")] = r.ID
+				for d := r.StartDate; d.After(r.EndDate) == false; d = d.AddDays(1) {
+					reservationMap[d.String()] = r.ID
 				}
 			} else {
-				blockMap[r.StartDate.Format("2006-01-02")] = r.ReservationID
+				blockMap[r.StartDate.String()] = r.ReservationID
 			}
 		}
 		data[fmt.Sprintf("reservation_map_%d", room.ID)] = reservationMap
@@ -538,10 +786,24 @@ func (repo *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Requ
 		helpers.ServerError(w, err)
 	}
 
+	reservation, err := repo.DB.GetReservation(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := repo.DB.GetAllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
 	stringMap := make(map[string]string)
 	stringMap["src"] = src
+	stringMap["start_date"] = reservation.StartDate.Format("2006-01-02")
+	stringMap["end_date"] = reservation.EndDate.Format("2006-01-02")
 
-	reservation, err := repo.DB.GetReservation(id)
+	history, err := repo.DB.GetPaymentsForReservation(id)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
@@ -549,10 +811,34 @@ func (repo *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Requ
 
 	data := make(map[string]interface{})
 	data["reservation"] = reservation
+	data["rooms"] = rooms
+	data["payments"] = history
+
+	if reservation.GuestID > 0 {
+		guest, err := repo.DB.GetGuest(reservation.GuestID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		data["guest"] = guest
+	}
+
+	intMap := make(map[string]int)
+	intMap["cancel_penalty"], intMap["cancel_refund"] = cancellationTerms(reservation, repo.now())
+
+	if reservation.BookingID > 0 {
+		group, err := repo.DB.GetBookingReservations(reservation.BookingID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		data["group"] = group
+	}
 
 	render.Template(w, r, "admin-reservation-show.page.gohtml", &models.TemplateData{
 		Data:      data,
 		StringMap: stringMap,
+		IntMap:    intMap,
 		Form:      forms.New(nil),
 	})
 }
@@ -574,6 +860,8 @@ func (repo *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.
 
 	stringMap := make(map[string]string)
 	stringMap["src"] = src
+	stringMap["start_date"] = r.Form.Get("start_date")
+	stringMap["end_date"] = r.Form.Get("end_date")
 
 	reservation, err := repo.DB.GetReservation(id)
 	if err != nil {
@@ -581,18 +869,101 @@ func (repo *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.
 		return
 	}
 
+	previous := reservation
+
 	reservation.FirstName = r.Form.Get("first_name")
 	reservation.LastName = r.Form.Get("last_name")
 	reservation.Email = r.Form.Get("email")
 	reservation.Phone = r.Form.Get("phone")
 
-	err = repo.DB.UpdateReservation(reservation)
-	if err != nil {
-		helpers.ServerError(w, err)
+	form := forms.New(r.PostForm)
+	form.Required("first_name", "last_name", "email", "start_date", "end_date", "room_id")
+	form.IsEmail("email")
+	form.DateRange("start_date", "end_date", "2006-01-02")
+	form.IsInt("room_id")
+
+	if form.Valid() {
+		reservation.StartDate, _ = dates.Parse(r.Form.Get("start_date"))
+		reservation.EndDate, _ = dates.Parse(r.Form.Get("end_date"))
+		reservation.RoomID, _ = strconv.Atoi(r.Form.Get("room_id"))
+
+		if reservation.StartDate != previous.StartDate || reservation.EndDate != previous.EndDate || reservation.RoomID != previous.RoomID {
+			err = repo.repriceReservation(&reservation)
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+		}
+
+		err = repo.auditedDB(r).UpdateReservation(reservation)
+		if errors.Is(err, repository.ErrStayChanged) {
+			repo.AppConfig.Session.Put(r.Context(), "error", "This reservation was moved to trash meanwhile")
+			http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+			return
+		}
+		if errors.Is(err, repository.ErrNotAvailable) {
+			form.Errors.Add("start_date", "The room is not available for these dates")
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		rooms, err := repo.DB.GetAllRooms()
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		data := make(map[string]interface{})
+		data["reservation"] = reservation
+		data["rooms"] = rooms
+
+		render.Template(w, r, "admin-reservation-show.page.gohtml", &models.TemplateData{
+			Data:      data,
+			StringMap: stringMap,
+			Form:      form,
+		})
 		return
 	}
 
-	repo.AppConfig.Session.Put(r.Context(), "flash", "Changes saved")
+	moved := reservation.StartDate != previous.StartDate || reservation.EndDate != previous.EndDate || reservation.RoomID != previous.RoomID
+
+	if moved {
+		// the old dates may be what someone on the waitlist is after
+		go repo.ProcessWaitlist()
+	}
+
+	if moved && r.Form.Get("notify") == "1" {
+		room, err := repo.DB.GetRoomById(reservation.RoomID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		htmlMessage := fmt.Sprintf(`
+		<strong>Reservation Updated</strong><br>
+		Dear %s:, <br>
+		Your reservation has been changed to room %s from %s to %s.<br>
+		Check-in is from %s and check-out is by %s.
+	`, reservation.FirstName, room.RoomName, reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"),
+			room.CheckInTime, room.CheckOutTime)
+
+		repo.AppConfig.MailChan <- models.MailData{
+			To:       reservation.Email,
+			From:     "me@gmail.com",
+			Subject:  "Reservation Updated",
+			Content:  htmlMessage,
+			Template: "basic.html",
+		}
+	}
+
+	if reservation.Total != previous.Total {
+		repo.AppConfig.Session.Put(r.Context(), "flash", i18n.M("Changes saved, the new total is %s", render.Money(reservation.Total)))
+	} else {
+		repo.AppConfig.Session.Put(r.Context(), "flash", "Changes saved")
+	}
 	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
 }
 
@@ -604,7 +975,7 @@ func (repo *Repository) AdminProcessReservation(w http.ResponseWriter, r *http.R
 
 	src := chi.URLParam(r, "src")
 
-	err = repo.DB.UpdateProcessedForReservation(id, 1)
+	err = repo.auditedDB(r).UpdateProcessedForReservation(id, 1)
 	if err != nil {
 		helpers.ServerError(w, err)
 	}
@@ -621,11 +992,102 @@ func (repo *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Re
 
 	src := chi.URLParam(r, "src")
 
-	err = repo.DB.DeleteReservation(id)
+	res, err := repo.DB.GetReservation(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = repo.auditedDB(r).DeleteReservation(id)
+	if errors.Is(err, repository.ErrStayChanged) {
+		repo.AppConfig.Session.Put(r.Context(), "error", "This reservation was already moved to trash")
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+		return
+	}
 	if err != nil {
 		helpers.ServerError(w, err)
+		return
 	}
 
-	repo.AppConfig.Session.Put(r.Context(), "flash", "Reservation deleted")
+	go repo.ProcessWaitlist()
+
+	penalty, _ := cancellationTerms(res, repo.now())
+
+	refunded, err := repo.refundCancellation(r, res)
+	if err != nil {
+		repo.AppConfig.ErrorLog.Println(err)
+		repo.AppConfig.Session.Put(r.Context(), "error", "Reservation moved to trash, but the refund failed and must be made by hand")
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+		return
+	}
+
+	repo.AppConfig.Session.Put(r.Context(), "flash", i18n.M("Reservation moved to trash, cancellation penalty %s, %s refunded",
+		render.Money(penalty), render.Money(refunded)))
 	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
 }
+
+func (repo *Repository) AdminTrashReservations(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseReservationFilter(r.URL.Query())
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+	filter.Trashed = true
+
+	reservations, total, err := repo.DB.AllReservations(filter)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := repo.DB.GetAllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["reservations"] = reservations
+	data["rooms"] = rooms
+
+	stringMap, intMap := paginationData(r.URL.Query(), filter, total)
+	stringMap["src"] = "trash"
+
+	render.Template(w, r, "admin-trash-reservations.page.gohtml", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+		IntMap:    intMap,
+	})
+}
+
+func (repo *Repository) AdminRestoreReservation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = repo.auditedDB(r).RestoreReservation(id)
+	if errors.Is(err, repository.ErrNotAvailable) {
+		repo.AppConfig.Session.Put(r.Context(), "error", "The room has been booked or taken out of order for these dates since, reservation not restored")
+		http.Redirect(w, r, "/admin/reservations-trash", http.StatusSeeOther)
+		return
+	}
+	if errors.Is(err, repository.ErrRefunded) {
+		repo.AppConfig.Session.Put(r.Context(), "error", "The guest was refunded when this reservation was cancelled, make a new booking instead of restoring it")
+		http.Redirect(w, r, "/admin/reservations-trash", http.StatusSeeOther)
+		return
+	}
+	if errors.Is(err, repository.ErrStayChanged) {
+		repo.AppConfig.Session.Put(r.Context(), "error", "This reservation was already restored")
+		http.Redirect(w, r, "/admin/reservations-trash", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.AppConfig.Session.Put(r.Context(), "flash", "Reservation restored")
+	http.Redirect(w, r, "/admin/reservations-trash", http.StatusSeeOther)
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"github.com/chelobotix/booking-go/internal/models"
+	"net/http"
+	"time"
+)
+
+// holdRoom holds res.RoomID for the reservation dates while the guest checks out, releasing
+// any hold the reservation already had. Returns repository.ErrNotAvailable when the room is taken
+func (repo *Repository) holdRoom(res *models.Reservation) error {
+	repo.releaseHold(*res)
+
+	holdId, err := repo.DB.InsertHold(res.RoomID, res.StartDate, res.EndDate, time.Now().Add(repo.AppConfig.HoldDuration))
+	if err != nil {
+		res.HoldID = 0
+		return err
+	}
+
+	res.HoldID = holdId
+	return nil
+}
+
+// releaseHold frees the room held for res, if any. A failure is only logged since the
+// sweeper removes the hold once it expires anyway
+func (repo *Repository) releaseHold(res models.Reservation) {
+	if res.HoldID == 0 {
+		return
+	}
+
+	if err := repo.DB.ReleaseHold(res.HoldID); err != nil {
+		repo.AppConfig.ErrorLog.Println(err)
+	}
+}
+
+// releaseSessionHold frees the hold of the reservation the guest was checking out, if any
+func (repo *Repository) releaseSessionHold(r *http.Request) {
+	if res, ok := repo.AppConfig.Session.Get(r.Context(), "reservation").(models.Reservation); ok {
+		repo.releaseHold(res)
+	}
+}
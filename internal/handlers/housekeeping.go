@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/chelobotix/booking-go/internal/dates"
+	"github.com/chelobotix/booking-go/internal/helpers"
+	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/chelobotix/booking-go/internal/render"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// AdminHousekeeping shows the status of every room and the day's cleaning tasks from the guests
+// leaving and arriving, today unless another day is asked for
+func (repo *Repository) AdminHousekeeping(w http.ResponseWriter, r *http.Request) {
+	day := repo.today()
+	if q := r.URL.Query().Get("date"); q != "" {
+		parsed, err := dates.Parse(q)
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+		day = parsed
+	}
+
+	tasks, err := repo.DB.HousekeepingTasks(day)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	intMap := make(map[string]int)
+	for _, task := range tasks {
+		if task.Task() != "" {
+			intMap["tasks"]++
+		}
+		if task.Departure.ID > 0 {
+			intMap["departures"]++
+		}
+		if task.Arrival.ID > 0 {
+			intMap["arrivals"]++
+		}
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["date"] = day.String()
+	stringMap["previous"] = day.AddDays(-1).String()
+	stringMap["next"] = day.AddDays(1).String()
+
+	data := make(map[string]interface{})
+	data["day"] = day
+	data["tasks"] = tasks
+
+	render.Template(w, r, "admin-housekeeping.page.gohtml", &models.TemplateData{
+		StringMap: stringMap,
+		IntMap:    intMap,
+		Data:      data,
+	})
+}
+
+// AdminPostRoomStatus records that a room was cleaned, inspected, left dirty or taken out of order.
+// Out of order rooms need a note saying what is wrong and can't be booked until they are back
+func (repo *Repository) AdminPostRoomStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	back := "/admin/housekeeping"
+	if d, err := dates.Parse(r.Form.Get("date")); err == nil {
+		back += "?date=" + d.String()
+	}
+
+	status := r.Form.Get("status")
+	note := strings.TrimSpace(r.Form.Get("note"))
+
+	valid := false
+	for _, s := range models.RoomStatuses {
+		if s == status {
+			valid = true
+		}
+	}
+	if !valid {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if status == models.RoomOutOfOrder && note == "" {
+		repo.AppConfig.Session.Put(r.Context(), "error", "Say what is wrong with a room taken out of order")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	err = repo.auditedDB(r).UpdateRoomStatus(id, status, note)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if status == models.RoomOutOfOrder {
+		repo.AppConfig.Session.Put(r.Context(), "flash", "Room taken out of order, it can't be booked until its status changes")
+
+		// stays already booked in the room keep it, staff move them or fix the room in time
+		stays, err := repo.DB.StaysInRoom(id, repo.today())
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		if len(stays) > 0 {
+			var affected []string
+			for _, stay := range stays {
+				affected = append(affected, fmt.Sprintf("#%d %s %s (%s to %s)", stay.ID, stay.FirstName, stay.LastName, stay.StartDate, stay.EndDate))
+			}
+			repo.AppConfig.Session.Put(r.Context(), "warning", "These stays are booked in the room, move them to another one: "+strings.Join(affected, ", "))
+		}
+	} else {
+		repo.AppConfig.Session.Put(r.Context(), "flash", "Room status saved")
+	}
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
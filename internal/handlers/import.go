@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/chelobotix/booking-go/internal/helpers"
+	"github.com/chelobotix/booking-go/internal/importer"
+	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/chelobotix/booking-go/internal/render"
+	"github.com/chelobotix/booking-go/internal/repository"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxImportSize is the largest import file accepted from the upload form
+const maxImportSize = 10 << 20
+
+// importLifetime is how long a checked import file waits to be committed. Files left behind by
+// uploads that were never committed are removed after it, they hold guests' personal details
+const importLifetime = 2 * time.Hour
+
+// importToken matches the names given to checked import files waiting to be committed
+var importToken = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// importPath returns where the checked import file named token is kept
+func importPath(token string) string {
+	return filepath.Join(os.TempDir(), "booking-import-"+token+".csv")
+}
+
+// saveImport keeps a checked import file on the server until it is committed and returns its name
+func saveImport(content string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	if err := os.WriteFile(importPath(token), []byte(content), 0600); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// loadImport reads back the checked import file named token, or nothing when it is gone
+func loadImport(token string) (string, error) {
+	if !importToken.MatchString(token) {
+		return "", nil
+	}
+
+	info, err := os.Stat(importPath(token))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if time.Since(info.ModTime()) > importLifetime {
+		removeImport(token)
+		return "", nil
+	}
+
+	data, err := os.ReadFile(importPath(token))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+
+	return string(data), err
+}
+
+// removeImport deletes the checked import file named token, if there is one
+func removeImport(token string) {
+	if importToken.MatchString(token) {
+		os.Remove(importPath(token))
+	}
+}
+
+// RemoveStaleImports deletes the checked import files older than importLifetime and returns how
+// many there were
+func RemoveStaleImports() (int, error) {
+	files, err := filepath.Glob(importPath("*"))
+	if err != nil {
+		return 0, err
+	}
+
+	var removed int
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil || time.Since(info.ModTime()) <= importLifetime {
+			continue
+		}
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// AdminImport shows the reservation import form
+func (repo *Repository) AdminImport(w http.ResponseWriter, r *http.Request) {
+	stringMap := make(map[string]string)
+	stringMap["columns"] = strings.Join(importer.Columns, ",")
+
+	render.Template(w, r, "admin-import.page.gohtml", &models.TemplateData{
+		StringMap: stringMap,
+	})
+}
+
+// AdminPostImport checks an uploaded import file and, when asked to, commits it.
+// The file from the dry run is kept on the server, named in the session, so it can be committed
+// without uploading it again
+func (repo *Repository) AdminPostImport(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseMultipartForm(maxImportSize)
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	commit := r.Form.Get("action") == "commit"
+
+	var content string
+
+	file, _, err := r.FormFile("file")
+	switch {
+	case err == nil:
+		defer file.Close()
+		data, err := io.ReadAll(file)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		content = string(data)
+	case errors.Is(err, http.ErrMissingFile):
+		content, err = loadImport(repo.AppConfig.Session.GetString(r.Context(), "import_file"))
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	default:
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if content == "" {
+		repo.AppConfig.Session.Put(r.Context(), "error", "Choose a file to import")
+		http.Redirect(w, r, "/admin/import", http.StatusSeeOther)
+		return
+	}
+
+	report, err := importer.Run(repo.auditedDB(r), strings.NewReader(content), commit)
+	if commit && errors.Is(err, repository.ErrNotAvailable) {
+		// a room was booked between the check and the commit, check the file again to show where
+		repo.AppConfig.Session.Put(r.Context(), "error", "A room in the file was booked meanwhile, nothing was imported. Check the report again")
+		report, err = importer.Run(repo.auditedDB(r), strings.NewReader(content), false)
+	}
+
+	var fileErr *importer.FileError
+	if errors.As(err, &fileErr) {
+		repo.AppConfig.Session.Put(r.Context(), "error", fileErr.Error())
+		http.Redirect(w, r, "/admin/import", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if report.Committed {
+		removeImport(repo.AppConfig.Session.PopString(r.Context(), "import_file"))
+		repo.AppConfig.Session.Put(r.Context(), "flash", "Import committed")
+		http.Redirect(w, r, "/admin/reservations-all", http.StatusSeeOther)
+		return
+	}
+
+	removeImport(repo.AppConfig.Session.GetString(r.Context(), "import_file"))
+
+	token, err := saveImport(content)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	repo.AppConfig.Session.Put(r.Context(), "import_file", token)
+
+	data := make(map[string]interface{})
+	data["report"] = report
+
+	stringMap := make(map[string]string)
+	stringMap["columns"] = strings.Join(importer.Columns, ",")
+
+	render.Template(w, r, "admin-import.page.gohtml", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
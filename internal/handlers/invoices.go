@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/chelobotix/booking-go/internal/helpers"
+	"github.com/chelobotix/booking-go/internal/invoice"
+	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+)
+
+// invoicePDF issues the invoice for a reservation, if it hasn't been yet, and returns it as a PDF
+func (repo *Repository) invoicePDF(reservationId int) (models.Invoice, []byte, error) {
+	inv, err := repo.DB.IssueInvoice(reservationId, repo.AppConfig.PropertyName, repo.AppConfig.TaxPercent)
+	if err != nil {
+		return inv, nil, err
+	}
+
+	var buf bytes.Buffer
+	err = invoice.Write(&buf, invoice.Document{
+		Invoice:  inv,
+		TimeZone: repo.AppConfig.TimeZone,
+	})
+
+	return inv, buf.Bytes(), err
+}
+
+// invoiceAttachments returns the invoices of the reservations to attach to their confirmation email.
+// A confirmation is still worth sending without them, so failures are only logged
+func (repo *Repository) invoiceAttachments(reservationIds ...int) []models.MailAttachment {
+	var attachments []models.MailAttachment
+
+	for _, id := range reservationIds {
+		inv, pdf, err := repo.invoicePDF(id)
+		if err != nil {
+			repo.AppConfig.ErrorLog.Println(fmt.Errorf("invoice for reservation %d: %w", id, err))
+			continue
+		}
+
+		attachments = append(attachments, models.MailAttachment{
+			Name:        invoice.FileName(inv),
+			ContentType: invoice.ContentType,
+			Data:        pdf,
+		})
+	}
+
+	return attachments
+}
+
+// AdminReservationInvoice downloads the invoice for a reservation
+func (repo *Repository) AdminReservationInvoice(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	inv, pdf, err := repo.invoicePDF(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", invoice.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, invoice.FileName(inv)))
+	w.Write(pdf)
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"github.com/chelobotix/booking-go/internal/dates"
+	"github.com/chelobotix/booking-go/internal/i18n"
+	"net/http"
+)
+
+// locale is the language the request is served in
+func locale(r *http.Request) string {
+	return i18n.LocaleFrom(r.Context())
+}
+
+// translator returns functions translating messages and formatting dates into locale, for
+// the text built outside templates such as emails
+func (repo *Repository) translator(locale string) (func(string, ...interface{}) string, func(dates.Date) string) {
+	translations := repo.AppConfig.Translations
+
+	t := func(message string, args ...interface{}) string {
+		return translations.Translate(locale, message, args...)
+	}
+	date := func(day dates.Date) string {
+		return translations.Date(locale, day.Time())
+	}
+
+	return t, date
+}
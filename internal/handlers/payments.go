@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/chelobotix/booking-go/internal/currency"
+	"github.com/chelobotix/booking-go/internal/forms"
+	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/chelobotix/booking-go/internal/payments"
+	"github.com/chelobotix/booking-go/internal/pricing"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// cardExpiry matches MM/YY
+var cardExpiry = regexp.MustCompile(`^(0[1-9]|1[0-2])/(\d{2})$`)
+
+// checkCard validates the card fields of a booking form
+func checkCard(form *forms.Form, now time.Time) {
+	form.Required("card_name", "card_number", "card_expiry", "card_cvc")
+
+	if form.Get("card_expiry") == "" {
+		return
+	}
+
+	m := cardExpiry.FindStringSubmatch(form.Get("card_expiry"))
+	if m == nil {
+		form.Errors.Add("card_expiry", "Enter the expiry date as MM/YY")
+		return
+	}
+
+	month, _ := strconv.Atoi(m[1])
+	year, _ := strconv.Atoi(m[2])
+	// a card is valid through the last day of its expiry month
+	if !now.Before(time.Date(2000+year, time.Month(month)+1, 1, 0, 0, 0, 0, time.UTC)) {
+		form.Errors.Add("card_expiry", "This card has expired")
+	}
+}
+
+// chargeDeposit charges deposit to the card entered in the form, in the currency the guest books in,
+// and returns the payment to record in the base currency, or none when no deposit is due. A declined
+// card is reported in the form error bag
+func (repo *Repository) chargeDeposit(form *forms.Form, deposit int, cur models.Currency, description string) ([]models.Payment, error) {
+	return repo.chargeCard(form, deposit, cur, description, "Deposit")
+}
+
+// chargeCard charges amount to the card entered in the form in cur, like chargeDeposit, recording
+// the payment under label
+func (repo *Repository) chargeCard(form *forms.Form, amount int, cur models.Currency, description, label string) ([]models.Payment, error) {
+	if amount <= 0 {
+		return nil, nil
+	}
+
+	card := payments.Card{
+		Name:   form.Get("card_name"),
+		Number: form.Get("card_number"),
+		Expiry: form.Get("card_expiry"),
+		CVC:    form.Get("card_cvc"),
+	}
+
+	reference, err := repo.AppConfig.PaymentGateway.Charge(card, currency.Convert(amount, cur), cur.Code, description)
+	if errors.Is(err, payments.ErrDeclined) {
+		form.Errors.Add("card_number", "Your card was declined")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return []models.Payment{{
+		Kind:        models.PaymentCharge,
+		Amount:      amount,
+		Description: label,
+		Reference:   reference,
+	}}, nil
+}
+
+// voidPayments gives back charges taken in cur for a booking that could not be made
+func (repo *Repository) voidPayments(charges []models.Payment, cur models.Currency) {
+	for _, p := range charges {
+		if _, err := repo.AppConfig.PaymentGateway.Refund(p.Reference, currency.Convert(p.Amount, cur)); err != nil {
+			repo.AppConfig.ErrorLog.Println(fmt.Errorf("refunding charge %s: %w", p.Reference, err))
+		}
+	}
+}
+
+// cancellationTerms returns the penalty for cancelling res at now under the policy it was booked
+// under, and how much of what has been paid goes back to the guest
+func cancellationTerms(res models.Reservation, now time.Time) (int, int) {
+	penalty := pricing.Penalty(res.CancellationPolicy, res, now)
+	return penalty, max(res.Paid-penalty, 0)
+}
+
+// refundCancellation refunds what the cancellation policy gives back on a cancelled reservation,
+// newest charges first, and returns the amount refunded
+func (repo *Repository) refundCancellation(r *http.Request, res models.Reservation) (int, error) {
+	_, refundable := cancellationTerms(res, repo.now())
+	return repo.refundPaid(r, res, refundable, "Refund on cancellation")
+}
+
+// refundPaid refunds up to amount of what was paid on res, newest charges first, recording the
+// refunds under label, and returns the amount refunded
+func (repo *Repository) refundPaid(r *http.Request, res models.Reservation, amount int, label string) (int, error) {
+	if amount <= 0 {
+		return 0, nil
+	}
+
+	history, err := repo.DB.GetPaymentsForReservation(res.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	refunded := make(map[int]int)
+	for _, p := range history {
+		if p.Kind == models.PaymentRefund {
+			refunded[p.RefundOf] += p.Amount
+		}
+	}
+
+	var total int
+	for i := len(history) - 1; i >= 0 && total < amount; i-- {
+		charge := history[i]
+		if charge.Kind != models.PaymentCharge || charge.Reference == "" {
+			continue
+		}
+
+		part := min(charge.Amount-refunded[charge.ID], amount-total)
+		if part <= 0 {
+			continue
+		}
+
+		// the guest gets back the amount in the currency they paid in, at the rate they booked at
+		reference, err := repo.AppConfig.PaymentGateway.Refund(charge.Reference, currency.Convert(part, res.Currency))
+		if err != nil {
+			return total, err
+		}
+
+		_, err = repo.auditedDB(r).InsertPayment(models.Payment{
+			ReservationID: res.ID,
+			Kind:          models.PaymentRefund,
+			Amount:        part,
+			Description:   label,
+			Reference:     reference,
+			RefundOf:      charge.ID,
+		})
+		if err != nil {
+			return total, err
+		}
+
+		total += part
+	}
+
+	return total, nil
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/chelobotix/booking-go/internal/forms"
+	"github.com/chelobotix/booking-go/internal/helpers"
+	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/chelobotix/booking-go/internal/pricing"
+	"github.com/chelobotix/booking-go/internal/render"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+)
+
+// attachPolicy sets the cancellation policy that applies to res's room, none when there is no active policy
+func (repo *Repository) attachPolicy(res *models.Reservation) error {
+	policy, err := repo.DB.GetCancellationPolicyForRoom(res.RoomID)
+	if errors.Is(err, sql.ErrNoRows) {
+		policy = models.CancellationPolicy{}
+	} else if err != nil {
+		return err
+	}
+
+	res.CancellationPolicyID = policy.ID
+	res.CancellationPolicy = policy
+
+	return nil
+}
+
+// policyText is the cancellation policy as shown to guests, with its description if it has one.
+// The terms are translated with t, the description is shown as staff wrote it
+func policyText(t func(string, ...interface{}) string, policy models.CancellationPolicy) string {
+	terms := pricing.PolicyTerms(policy)
+	if policy.Description != "" {
+		return t(terms.Key, terms.Args...) + ". " + policy.Description
+	}
+	return t(terms.Key, terms.Args...)
+}
+
+// AdminCancellationPolicies lists the cancellation policies with a form to add one
+func (repo *Repository) AdminCancellationPolicies(w http.ResponseWriter, r *http.Request) {
+	policy := models.CancellationPolicy{
+		FreeDays:    7,
+		PenaltyKind: models.PenaltyPercent,
+		Active:      true,
+	}
+
+	repo.renderCancellationPolicies(w, r, policy, forms.New(nil))
+}
+
+// AdminPostCancellationPolicy adds a cancellation policy
+func (repo *Repository) AdminPostCancellationPolicy(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "penalty_kind")
+
+	policy := models.CancellationPolicy{
+		Name:        r.Form.Get("name"),
+		Description: r.Form.Get("description"),
+		PenaltyKind: r.Form.Get("penalty_kind"),
+		Active:      true,
+	}
+	policy.RoomID, _ = strconv.Atoi(r.Form.Get("room_id"))
+
+	if form.Get("free_days") != "" && form.IsInt("free_days") {
+		policy.FreeDays, _ = strconv.Atoi(form.Get("free_days"))
+		if policy.FreeDays < 0 {
+			form.Errors.Add("free_days", "This field can't be negative")
+		}
+	}
+
+	switch policy.PenaltyKind {
+	case models.PenaltyPercent:
+		if form.IsInt("penalty_amount") {
+			policy.PenaltyAmount, _ = strconv.Atoi(form.Get("penalty_amount"))
+			if policy.PenaltyAmount < 1 || policy.PenaltyAmount > 100 {
+				form.Errors.Add("penalty_amount", "Enter a percentage between 1 and 100")
+			}
+		}
+	case models.PenaltyFirstNight:
+	default:
+		form.Errors.Add("penalty_kind", "Choose a percentage or the first night")
+	}
+
+	if !form.Valid() {
+		repo.renderCancellationPolicies(w, r, policy, form)
+		return
+	}
+
+	_, err = repo.auditedDB(r).InsertCancellationPolicy(policy)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.AppConfig.Session.Put(r.Context(), "flash", "Cancellation policy added")
+	http.Redirect(w, r, "/admin/cancellation-policies", http.StatusSeeOther)
+}
+
+// AdminToggleCancellationPolicy switches a cancellation policy on or off for new bookings
+func (repo *Repository) AdminToggleCancellationPolicy(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	active := r.URL.Query().Get("active") == "1"
+
+	err = repo.auditedDB(r).SetCancellationPolicyActive(id, active)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if active {
+		repo.AppConfig.Session.Put(r.Context(), "flash", "Cancellation policy activated")
+	} else {
+		repo.AppConfig.Session.Put(r.Context(), "flash", "Cancellation policy deactivated")
+	}
+	http.Redirect(w, r, "/admin/cancellation-policies", http.StatusSeeOther)
+}
+
+// renderCancellationPolicies renders the cancellation policies page
+func (repo *Repository) renderCancellationPolicies(w http.ResponseWriter, r *http.Request, policy models.CancellationPolicy, form *forms.Form) {
+	policies, err := repo.DB.GetCancellationPolicies()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := repo.DB.GetAllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["policies"] = policies
+	data["policy"] = policy
+	data["rooms"] = rooms
+
+	render.Template(w, r, "admin-cancellation-policies.page.gohtml", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
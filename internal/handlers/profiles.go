@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/chelobotix/booking-go/internal/forms"
+	"github.com/chelobotix/booking-go/internal/helpers"
+	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/chelobotix/booking-go/internal/render"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+)
+
+// rememberGuest keeps the email of the guest who just booked in their session so their
+// next booking can be prefilled
+func (repo *Repository) rememberGuest(r *http.Request, email string) {
+	repo.AppConfig.Session.Put(r.Context(), "guest_email", email)
+}
+
+// prefillGuest fills in the contact details of a returning guest when res has none yet
+func (repo *Repository) prefillGuest(r *http.Request, res *models.Reservation) error {
+	email := repo.AppConfig.Session.GetString(r.Context(), "guest_email")
+	if email == "" || res.Email != "" {
+		return nil
+	}
+
+	guest, err := repo.DB.GetGuestByEmail(email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	res.FirstName = guest.FirstName
+	res.LastName = guest.LastName
+	res.Email = guest.Email
+	res.Phone = guest.Phone
+
+	return nil
+}
+
+// AdminGuests lists the guests, optionally searched by name, email or phone
+func (repo *Repository) AdminGuests(w http.ResponseWriter, r *http.Request) {
+	search := r.URL.Query().Get("q")
+
+	guests, err := repo.DB.AllGuests(search)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["guests"] = guests
+
+	stringMap := make(map[string]string)
+	stringMap["q"] = search
+
+	render.Template(w, r, "admin-guests.page.gohtml", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// AdminShowGuest shows a guest's profile and stay history
+func (repo *Repository) AdminShowGuest(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	guest, err := repo.DB.GetGuest(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.renderGuest(w, r, guest, forms.New(nil))
+}
+
+// AdminPostGuest saves a guest's profile
+func (repo *Repository) AdminPostGuest(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	guest, err := repo.DB.GetGuest(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	guest.FirstName = r.Form.Get("first_name")
+	guest.LastName = r.Form.Get("last_name")
+	guest.Phone = r.Form.Get("phone")
+	guest.Notes = r.Form.Get("notes")
+	guest.Preferences = r.Form.Get("preferences")
+
+	form := forms.New(r.PostForm)
+	form.Required("first_name", "last_name")
+
+	if !form.Valid() {
+		repo.renderGuest(w, r, guest, form)
+		return
+	}
+
+	err = repo.auditedDB(r).UpdateGuest(guest)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.AppConfig.Session.Put(r.Context(), "flash", "Guest saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/guests/%d", id), http.StatusSeeOther)
+}
+
+// renderGuest renders a guest's profile page
+func (repo *Repository) renderGuest(w http.ResponseWriter, r *http.Request, guest models.Guest, form *forms.Form) {
+	reservations, err := repo.DB.GetGuestReservations(guest.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["guest"] = guest
+	data["reservations"] = reservations
+
+	render.Template(w, r, "admin-guest-show.page.gohtml", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/chelobotix/booking-go/internal/dates"
+	"github.com/chelobotix/booking-go/internal/forms"
+	"github.com/chelobotix/booking-go/internal/helpers"
+	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/chelobotix/booking-go/internal/pricing"
+	"github.com/chelobotix/booking-go/internal/render"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+)
+
+// priceReservation prices res at its room's current rate with the promo code entered in the
+// form field promo_code, if any, and attaches the room's cancellation policy. A code that can't
+// be used is reported in the form error bag
+func (repo *Repository) priceReservation(form *forms.Form, res *models.Reservation) error {
+	room, err := repo.DB.GetRoomById(res.RoomID)
+	if err != nil {
+		return err
+	}
+
+	if err := repo.attachPolicy(res); err != nil {
+		return err
+	}
+
+	var promo *models.PromoCode
+
+	if code := pricing.NormalizeCode(form.Get("promo_code")); code != "" {
+		found, err := repo.DB.GetPromoCodeByCode(code)
+		if errors.Is(err, sql.ErrNoRows) {
+			form.Errors.Add("promo_code", "Unknown promo code")
+		} else if err != nil {
+			return err
+		} else if msg := pricing.CheckPromo(found, res.RoomID, res.StartDate, res.EndDate, repo.now()); msg.Key != "" {
+			form.Errors.AddMessage("promo_code", msg)
+		} else {
+			promo = &found
+		}
+	}
+
+	pricing.Apply(res, room, promo)
+
+	return nil
+}
+
+// AdminPromoCodes lists the promo codes with a form to add one
+func (repo *Repository) AdminPromoCodes(w http.ResponseWriter, r *http.Request) {
+	repo.renderPromoCodes(w, r, models.PromoCode{Kind: models.PromoPercent, Active: true}, forms.New(nil))
+}
+
+// AdminPostPromoCode adds a promo code
+func (repo *Repository) AdminPostPromoCode(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("code", "kind", "amount")
+
+	promo := models.PromoCode{
+		Code:        pricing.NormalizeCode(r.Form.Get("code")),
+		Description: r.Form.Get("description"),
+		Kind:        r.Form.Get("kind"),
+		Active:      true,
+	}
+
+	if promo.Kind != models.PromoPercent && promo.Kind != models.PromoFixed {
+		form.Errors.Add("kind", "Choose percentage or fixed amount")
+	}
+
+	if form.Has("amount", r) {
+		if promo.Kind == models.PromoFixed {
+			// fixed amounts are entered in currency units with up to two decimals
+			amount, err := strconv.ParseFloat(form.Get("amount"), 64)
+			if err != nil || amount <= 0 {
+				form.Errors.Add("amount", "Enter an amount above 0")
+			}
+			promo.Amount = int(amount*100 + 0.5)
+		} else if form.IsInt("amount") {
+			promo.Amount, _ = strconv.Atoi(form.Get("amount"))
+			if promo.Amount < 1 || promo.Amount > 100 {
+				form.Errors.Add("amount", "Enter a percentage between 1 and 100")
+			}
+		}
+	}
+
+	if form.Get("valid_from") != "" && form.IsDate("valid_from", dates.Layout) {
+		promo.ValidFrom, _ = dates.Parse(form.Get("valid_from"))
+	}
+	if form.Get("valid_to") != "" && form.IsDate("valid_to", dates.Layout) {
+		promo.ValidTo, _ = dates.Parse(form.Get("valid_to"))
+	}
+	if !promo.ValidFrom.IsZero() && !promo.ValidTo.IsZero() && promo.ValidTo.Before(promo.ValidFrom) {
+		form.Errors.Add("valid_to", "The code must end after it starts")
+	}
+
+	for field, limit := range map[string]*int{
+		"min_nights": &promo.MinNights,
+		"max_uses":   &promo.MaxUses,
+	} {
+		if form.Get(field) != "" && form.IsInt(field) {
+			*limit, _ = strconv.Atoi(form.Get(field))
+			if *limit < 0 {
+				form.Errors.Add(field, "This field can't be negative")
+			}
+		}
+	}
+
+	for _, id := range r.Form["room_ids"] {
+		if roomId, err := strconv.Atoi(id); err == nil {
+			promo.RoomIDs = append(promo.RoomIDs, roomId)
+		}
+	}
+
+	if promo.Code != "" {
+		_, err := repo.DB.GetPromoCodeByCode(promo.Code)
+		if err == nil {
+			form.Errors.Add("code", "This code already exists")
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		repo.renderPromoCodes(w, r, promo, form)
+		return
+	}
+
+	_, err = repo.auditedDB(r).InsertPromoCode(promo)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.AppConfig.Session.Put(r.Context(), "flash", "Promo code added")
+	http.Redirect(w, r, "/admin/promo-codes", http.StatusSeeOther)
+}
+
+// AdminTogglePromoCode switches a promo code on or off
+func (repo *Repository) AdminTogglePromoCode(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	active := r.URL.Query().Get("active") == "1"
+
+	err = repo.auditedDB(r).SetPromoCodeActive(id, active)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if active {
+		repo.AppConfig.Session.Put(r.Context(), "flash", "Promo code activated")
+	} else {
+		repo.AppConfig.Session.Put(r.Context(), "flash", "Promo code deactivated")
+	}
+	http.Redirect(w, r, "/admin/promo-codes", http.StatusSeeOther)
+}
+
+// renderPromoCodes renders the promo codes page
+func (repo *Repository) renderPromoCodes(w http.ResponseWriter, r *http.Request, promo models.PromoCode, form *forms.Form) {
+	promos, err := repo.DB.GetPromoCodes()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := repo.DB.GetAllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	roomNames := make(map[int]string)
+	for _, room := range rooms {
+		roomNames[room.ID] = room.RoomName
+	}
+
+	data := make(map[string]interface{})
+	data["promos"] = promos
+	data["promo"] = promo
+	data["rooms"] = rooms
+	data["room_names"] = roomNames
+
+	render.Template(w, r, "admin-promo-codes.page.gohtml", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"github.com/chelobotix/booking-go/internal/forms"
+	"github.com/chelobotix/booking-go/internal/helpers"
+	"github.com/chelobotix/booking-go/internal/i18n"
+	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/chelobotix/booking-go/internal/render"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// clockLayout is how check-in and check-out times are written
+const clockLayout = "15:04"
+
+// AdminRooms lists the rooms with their check-in and check-out times and how they are turned over
+func (repo *Repository) AdminRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := repo.DB.GetAllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
+
+	render.Template(w, r, "admin-rooms.page.gohtml", &models.TemplateData{
+		Data: data,
+		Form: forms.New(nil),
+	})
+}
+
+// turnoverFromForm reads and checks the check-in and check-out times, cleaning buffer and
+// same-day turnover of a room
+func turnoverFromForm(form *forms.Form, room *models.Room) {
+	form.Required("check_in_time", "check_out_time", "buffer_days")
+
+	room.CheckInTime = clockFromForm(form, "check_in_time", room.CheckInTime)
+	room.CheckOutTime = clockFromForm(form, "check_out_time", room.CheckOutTime)
+
+	if form.Get("buffer_days") != "" && form.IsInt("buffer_days") {
+		room.BufferDays, _ = strconv.Atoi(form.Get("buffer_days"))
+		if room.BufferDays < 0 {
+			form.Errors.Add("buffer_days", "Enter 0 or more days")
+		}
+	}
+
+	room.SameDayTurnover = form.Get("same_day_turnover") == "1"
+	if room.SameDayTurnover && room.BufferDays == 0 && form.Valid() && room.CheckOutTime >= room.CheckInTime {
+		form.Errors.Add("same_day_turnover", "Guests can only arrive the day others leave when check-out is before check-in")
+	}
+}
+
+// clockFromForm reads a time of day from field written as 15:04, keeping current when it is missing or wrong
+func clockFromForm(form *forms.Form, field, current string) string {
+	if form.Get(field) == "" {
+		return current
+	}
+
+	t, err := time.Parse(clockLayout, form.Get(field))
+	if err != nil {
+		form.Errors.Add(field, "Enter a time such as 15:00")
+		return current
+	}
+
+	return t.Format(clockLayout)
+}
+
+// AdminPostRoom changes a room's check-in and check-out times and how it is turned over between stays
+func (repo *Repository) AdminPostRoom(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	room, err := repo.DB.GetRoomById(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	turnoverFromForm(form, &room)
+
+	if !form.Valid() {
+		for _, field := range []string{"check_in_time", "check_out_time", "buffer_days", "same_day_turnover"} {
+			if msg := form.Errors.Message(field); msg.Key != "" {
+				repo.AppConfig.Session.Put(r.Context(), "error", i18n.M("%s: %s", room.RoomName, msg))
+				break
+			}
+		}
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+
+	err = repo.auditedDB(r).UpdateRoomTurnover(room)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.AppConfig.Session.Put(r.Context(), "flash", "Room saved")
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"github.com/chelobotix/booking-go/internal/dates"
+	"github.com/chelobotix/booking-go/internal/forms"
+	"github.com/chelobotix/booking-go/internal/helpers"
+	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/chelobotix/booking-go/internal/render"
+	"github.com/chelobotix/booking-go/internal/rules"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// addViolations puts broken booking rules in the form error bag under the form's date fields
+func addViolations(form *forms.Form, violations []rules.Violation, startField, endField string) {
+	for _, v := range violations {
+		if v.Field == rules.FieldStart {
+			form.Errors.AddMessage(startField, v.Message)
+		} else {
+			form.Errors.AddMessage(endField, v.Message)
+		}
+	}
+}
+
+// allowedRooms drops the rooms whose booking rules forbid the stay as of now, returning what they broke
+func allowedRooms(bookingRules []models.BookingRule, rooms []models.Room, start, end dates.Date, now time.Time) ([]models.Room, []rules.Violation) {
+	var allowed []models.Room
+	var violations []rules.Violation
+
+	for _, room := range rooms {
+		broken := rules.Check(bookingRules, room.ID, start, end, now)
+		if len(broken) > 0 {
+			violations = append(violations, broken...)
+			continue
+		}
+		allowed = append(allowed, room)
+	}
+
+	return allowed, violations
+}
+
+// AdminBookingRules lists the booking rules with a form to add one
+func (repo *Repository) AdminBookingRules(w http.ResponseWriter, r *http.Request) {
+	repo.renderBookingRules(w, r, models.BookingRule{}, forms.New(nil))
+}
+
+// AdminPostBookingRule adds a booking rule
+func (repo *Repository) AdminPostBookingRule(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name")
+
+	rule := models.BookingRule{Name: r.Form.Get("name")}
+	rule.RoomID, _ = strconv.Atoi(r.Form.Get("room_id"))
+
+	if form.Get("season_start") != "" || form.Get("season_end") != "" {
+		if form.DateRange("season_start", "season_end", dates.Layout) {
+			rule.SeasonStart, _ = dates.Parse(form.Get("season_start"))
+			rule.SeasonEnd, _ = dates.Parse(form.Get("season_end"))
+		}
+	}
+
+	for field, limit := range map[string]*int{
+		"min_nights":       &rule.MinNights,
+		"max_nights":       &rule.MaxNights,
+		"min_notice_hours": &rule.MinNoticeHours,
+		"max_horizon_days": &rule.MaxHorizonDays,
+	} {
+		if form.Get(field) == "" {
+			continue
+		}
+		if form.IsInt(field) {
+			*limit, _ = strconv.Atoi(form.Get(field))
+			if *limit < 0 {
+				form.Errors.Add(field, "This field can't be negative")
+			}
+		}
+	}
+
+	if rule.MaxNights > 0 && rule.MaxNights < rule.MinNights {
+		form.Errors.Add("max_nights", "Maximum stay must not be shorter than the minimum")
+	}
+
+	for _, day := range r.Form["no_arrival_days"] {
+		if d, err := strconv.Atoi(day); err == nil && d >= 0 && d <= 6 {
+			rule.NoArrivalDays = append(rule.NoArrivalDays, time.Weekday(d))
+		}
+	}
+	for _, day := range r.Form["no_departure_days"] {
+		if d, err := strconv.Atoi(day); err == nil && d >= 0 && d <= 6 {
+			rule.NoDepartureDays = append(rule.NoDepartureDays, time.Weekday(d))
+		}
+	}
+
+	if !form.Valid() {
+		repo.renderBookingRules(w, r, rule, form)
+		return
+	}
+
+	_, err = repo.auditedDB(r).InsertBookingRule(rule)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.AppConfig.Session.Put(r.Context(), "flash", "Booking rule added")
+	http.Redirect(w, r, "/admin/booking-rules", http.StatusSeeOther)
+}
+
+// AdminDeleteBookingRule removes a booking rule
+func (repo *Repository) AdminDeleteBookingRule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = repo.auditedDB(r).DeleteBookingRule(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.AppConfig.Session.Put(r.Context(), "flash", "Booking rule deleted")
+	http.Redirect(w, r, "/admin/booking-rules", http.StatusSeeOther)
+}
+
+// renderBookingRules renders the booking rules page
+func (repo *Repository) renderBookingRules(w http.ResponseWriter, r *http.Request, rule models.BookingRule, form *forms.Form) {
+	bookingRules, err := repo.DB.GetBookingRules()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := repo.DB.GetAllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var weekdays []time.Weekday
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		weekdays = append(weekdays, d)
+	}
+
+	data := make(map[string]interface{})
+	data["rules"] = bookingRules
+	data["rule"] = rule
+	data["rooms"] = rooms
+	data["weekdays"] = weekdays
+
+	render.Template(w, r, "admin-booking-rules.page.gohtml", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/chelobotix/booking-go/internal/dates"
+	"github.com/chelobotix/booking-go/internal/forms"
+	"github.com/chelobotix/booking-go/internal/helpers"
+	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/chelobotix/booking-go/internal/render"
+	"github.com/chelobotix/booking-go/internal/repository"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// waitlistMu keeps the sweeper and a cancellation from offering the same rooms at once
+var waitlistMu sync.Mutex
+
+// Waitlist shows the form to join the waitlist, prefilled from the search that found nothing
+func (repo *Repository) Waitlist(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	entry := models.WaitlistEntry{Adults: 1}
+	entry.RoomID, _ = strconv.Atoi(q.Get("room_id"))
+	if adults, err := strconv.Atoi(q.Get("adults")); err == nil && adults > 0 {
+		entry.Adults = adults
+	}
+	if children, err := strconv.Atoi(q.Get("children")); err == nil && children >= 0 {
+		entry.Children = children
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["start"] = q.Get("start")
+	stringMap["end"] = q.Get("end")
+
+	repo.renderWaitlist(w, r, entry, stringMap, forms.New(nil))
+}
+
+// PostWaitlist puts the guest on the waitlist
+func (repo *Repository) PostWaitlist(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	adults, children := parseGuests(r)
+	roomId, _ := strconv.Atoi(r.Form.Get("room_id"))
+
+	entry := models.WaitlistEntry{
+		FirstName: r.Form.Get("first_name"),
+		LastName:  r.Form.Get("last_name"),
+		Email:     r.Form.Get("email"),
+		RoomID:    roomId,
+		Adults:    adults,
+		Children:  children,
+		Locale:    locale(r),
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["start"] = r.Form.Get("start")
+	stringMap["end"] = r.Form.Get("end")
+
+	form := forms.New(r.PostForm)
+	form.Required("first_name", "last_name", "email", "start", "end")
+	form.IsEmail("email")
+	if form.DateRange("start", "end", dates.Layout) {
+		entry.StartDate, _ = dates.Parse(form.Get("start"))
+		entry.EndDate, _ = dates.Parse(form.Get("end"))
+
+		if !entry.StartDate.After(repo.today()) {
+			form.Errors.Add("start", "Arrival must be in the future")
+		}
+	}
+
+	if !form.Valid() {
+		repo.renderWaitlist(w, r, entry, stringMap, form)
+		return
+	}
+
+	_, err = repo.auditedDB(r).InsertWaitlistEntry(entry)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.AppConfig.Session.Put(r.Context(), "flash", "You are on the waitlist, we will email you if a room frees up")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// renderWaitlist renders the waitlist form
+func (repo *Repository) renderWaitlist(w http.ResponseWriter, r *http.Request, entry models.WaitlistEntry, stringMap map[string]string, form *forms.Form) {
+	rooms, err := repo.DB.GetAllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["entry"] = entry
+	data["rooms"] = rooms
+
+	render.Template(w, r, "waitlist.page.gohtml", &models.TemplateData{
+		Form:      form,
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// WaitlistOffer starts checkout for the room held for a waitlisted guest
+func (repo *Repository) WaitlistOffer(w http.ResponseWriter, r *http.Request) {
+	entry, err := repo.DB.GetWaitlistOffer(chi.URLParam(r, "token"))
+	if errors.Is(err, sql.ErrNoRows) {
+		repo.AppConfig.Session.Put(r.Context(), "error", "This offer has expired or has already been used")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	room, err := repo.DB.GetRoomById(entry.OfferedRoomID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repo.releaseSessionHold(r)
+
+	res := models.Reservation{
+		FirstName: entry.FirstName,
+		LastName:  entry.LastName,
+		Email:     entry.Email,
+		StartDate: entry.StartDate,
+		EndDate:   entry.EndDate,
+		RoomID:    room.ID,
+		Room:      room,
+		Adults:    entry.Adults,
+		Children:  entry.Children,
+		HoldID:    entry.HoldID,
+	}
+
+	repo.AppConfig.Session.Put(r.Context(), "reservation", res)
+
+	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
+}
+
+// ProcessWaitlist offers rooms that have freed up to waitlisted guests in the order they joined.
+// Each offer holds the room, so later entries only get what is still free
+func (repo *Repository) ProcessWaitlist() {
+	waitlistMu.Lock()
+	defer waitlistMu.Unlock()
+
+	entries, err := repo.DB.WaitingWaitlistEntries(repo.today())
+	if err != nil {
+		repo.AppConfig.ErrorLog.Println(err)
+		return
+	}
+
+	for _, entry := range entries {
+		room, err := repo.waitlistRoom(entry)
+		if err != nil {
+			repo.AppConfig.ErrorLog.Println(err)
+			continue
+		}
+		if room.ID == 0 {
+			continue
+		}
+
+		offer, err := repo.DB.OfferWaitlistEntry(entry.ID, room.ID, time.Now().Add(repo.AppConfig.WaitlistOfferDuration))
+		if errors.Is(err, repository.ErrNotAvailable) || errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			repo.AppConfig.ErrorLog.Println(err)
+			continue
+		}
+		offer.OfferedRoom = room
+
+		repo.sendWaitlistOffer(offer)
+	}
+}
+
+// waitlistRoom returns a free room matching the entry, or a zero Room when there is none
+func (repo *Repository) waitlistRoom(entry models.WaitlistEntry) (models.Room, error) {
+	guests := entry.Adults + entry.Children
+
+	if entry.RoomID == 0 {
+		rooms, err := repo.DB.SearchAvailabilityForAllRooms(entry.StartDate, entry.EndDate, guests)
+		if err != nil || len(rooms) == 0 {
+			return models.Room{}, err
+		}
+		return rooms[0], nil
+	}
+
+	available, err := repo.DB.SearchAvailabilityByDateByRoomId(entry.StartDate, entry.EndDate, entry.RoomID)
+	if err != nil || !available {
+		return models.Room{}, err
+	}
+
+	room, err := repo.DB.GetRoomById(entry.RoomID)
+	if err != nil {
+		return models.Room{}, err
+	}
+	if room.MaxOccupancy < guests {
+		return models.Room{}, nil
+	}
+
+	return room, nil
+}
+
+// sendWaitlistOffer emails the guest their time-limited booking link
+func (repo *Repository) sendWaitlistOffer(offer models.WaitlistEntry) {
+	link := fmt.Sprintf("%s/waitlist/%s", repo.AppConfig.SiteURL, offer.Token)
+
+	t, date := repo.translator(offer.Locale)
+	expires := offer.OfferExpiresAt.In(repo.AppConfig.TimeZone)
+
+	htmlMessage := fmt.Sprintf(`
+		<strong>%s</strong><br>
+		%s <br>
+		%s<br>
+		<a href="%s">%s</a>
+	`, t("A room is available"), t("Dear %s,", offer.FirstName),
+		t("%s is now available from %s to %s and we are holding it for you until %s.", offer.OfferedRoom.RoomName,
+			date(offer.StartDate), date(offer.EndDate), date(dates.Of(expires))+" "+expires.Format("15:04")),
+		link, t("Book it now"))
+
+	repo.AppConfig.MailChan <- models.MailData{
+		To:       offer.Email,
+		From:     "me@gmail.com",
+		Subject:  t("A room is available for your dates"),
+		Content:  htmlMessage,
+		Template: "basic.html",
+	}
+}
+
+// AdminWaitlist lists the waitlist with the state of each entry
+func (repo *Repository) AdminWaitlist(w http.ResponseWriter, r *http.Request) {
+	entries, err := repo.DB.AllWaitlistEntries()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["entries"] = entries
+
+	render.Template(w, r, "admin-waitlist.page.gohtml", &models.TemplateData{
+		Data: data,
+	})
+}
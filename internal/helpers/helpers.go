@@ -28,3 +28,8 @@ func IsAuthenticate(r *http.Request) bool {
 	exists := appConfig.Session.Exists(r.Context(), "user_id")
 	return exists
 }
+
+// IsGuest reports whether a guest is logged in to their account
+func IsGuest(r *http.Request) bool {
+	return appConfig.Session.Exists(r.Context(), "guest_id")
+}
@@ -0,0 +1,191 @@
+package i18n
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default is the language the site is written in, messages are looked up by their English text
+const Default = "en"
+
+// Bundle holds the message catalog of every language the site is translated to. A nil
+// Bundle, or a message missing from a catalog, gives the English text
+type Bundle struct {
+	catalogs map[string]map[string]string
+}
+
+// Message is text shown to people, kept as its English format, which is its key in the catalogs,
+// and the arguments it is formatted with, so it can be translated when it is shown. Arguments
+// that are messages themselves, such as a weekday, are translated too
+type Message struct {
+	Key  string
+	Args []interface{}
+}
+
+// M returns the message key formatted with args
+func M(key string, args ...interface{}) Message {
+	return Message{Key: key, Args: args}
+}
+
+// String formats the message in English
+func (m Message) String() string {
+	return (*Bundle)(nil).Message(Default, m)
+}
+
+// Load reads the catalogs in dir, one JSON object of English text to translation per
+// language named after it, such as es.json
+func Load(dir string) (*Bundle, error) {
+	b := &Bundle{catalogs: map[string]map[string]string{}}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		locale := strings.TrimSuffix(filepath.Base(file), ".json")
+		b.catalogs[locale] = messages
+	}
+
+	return b, nil
+}
+
+// Locales returns the languages the site can be shown in, English first
+func (b *Bundle) Locales() []string {
+	locales := []string{Default}
+	if b == nil {
+		return locales
+	}
+
+	var others []string
+	for locale := range b.catalogs {
+		if locale != Default {
+			others = append(others, locale)
+		}
+	}
+	sort.Strings(others)
+
+	return append(locales, others...)
+}
+
+// Supported reports whether the site can be shown in locale
+func (b *Bundle) Supported(locale string) bool {
+	if locale == Default {
+		return true
+	}
+	if b == nil {
+		return false
+	}
+	_, ok := b.catalogs[locale]
+	return ok
+}
+
+// Translate returns message in locale, formatted with args
+func (b *Bundle) Translate(locale, message string, args ...interface{}) string {
+	return b.Message(locale, M(message, args...))
+}
+
+// Message returns m in locale. A message with no args is shown as it is, so one built from
+// text that isn't a message, such as a file error, can't be mistaken for a format
+func (b *Bundle) Message(locale string, m Message) string {
+	text := m.Key
+	if b != nil {
+		if to, ok := b.catalogs[locale][m.Key]; ok {
+			text = to
+		}
+	}
+
+	if len(m.Args) == 0 {
+		return text
+	}
+
+	args := make([]interface{}, len(m.Args))
+	for i, arg := range m.Args {
+		if nested, ok := arg.(Message); ok {
+			arg = b.Message(locale, nested)
+		}
+		args[i] = arg
+	}
+
+	return fmt.Sprintf(text, args...)
+}
+
+// Date formats a day for people reading locale, using the "Jan 2, 2006" entry of its
+// catalog as the layout and its month abbreviations
+func (b *Bundle) Date(locale string, t time.Time) string {
+	layout := b.Translate(locale, "Jan 2, 2006")
+	if !strings.Contains(layout, "Jan") {
+		return t.Format(layout)
+	}
+
+	// the month is formatted as a marker and replaced, Go only knows English month names
+	month := b.Translate(locale, t.Month().String()[:3])
+	return strings.Replace(t.Format(strings.Replace(layout, "Jan", "\x00", 1)), "\x00", month, 1)
+}
+
+// Negotiate returns the supported language the Accept-Language header prefers most, or Default
+func (b *Bundle) Negotiate(acceptLanguage string) string {
+	type choice struct {
+		locale string
+		q      float64
+	}
+
+	var choices []choice
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+
+		// a regional tag like es-AR is served the language's catalog
+		locale, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if locale != "" && q > 0 {
+			choices = append(choices, choice{locale, q})
+		}
+	}
+
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].q > choices[j].q })
+
+	for _, c := range choices {
+		if b.Supported(c.locale) {
+			return c.locale
+		}
+	}
+
+	return Default
+}
+
+type contextKey struct{}
+
+// WithLocale returns a context carrying the language the request is served in
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, contextKey{}, locale)
+}
+
+// LocaleFrom returns the language a request is served in, Default when none was negotiated
+func LocaleFrom(ctx context.Context) string {
+	if locale, ok := ctx.Value(contextKey{}).(string); ok {
+		return locale
+	}
+	return Default
+}
@@ -0,0 +1,275 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/chelobotix/booking-go/internal/dates"
+	"github.com/chelobotix/booking-go/internal/forms"
+	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/chelobotix/booking-go/internal/repository"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Row kinds accepted in the type column
+const (
+	KindReservation = "reservation"
+	KindBlock       = "block"
+)
+
+// Columns is the expected header of an import file
+var Columns = []string{"type", "first_name", "last_name", "email", "phone", "start_date", "end_date", "room_id", "processed"}
+
+// Row is a single line of an import file with its validation result
+type Row struct {
+	Line        int
+	Kind        string
+	Reservation models.Reservation
+	Form        *forms.Form
+}
+
+// Valid returns true if the row has no errors
+func (r Row) Valid() bool {
+	return r.Form.Valid()
+}
+
+// Messages returns every error on the row as "field: message"
+func (r Row) Messages() []string {
+	var messages []string
+	for _, field := range Columns {
+		for _, msg := range r.Form.Errors[field] {
+			messages = append(messages, fmt.Sprintf("%s: %s", field, msg))
+		}
+	}
+	return messages
+}
+
+// Report is the outcome of checking an import file
+type Report struct {
+	Rows      []Row
+	Committed bool
+}
+
+// Valid returns true if every row passed validation
+func (r *Report) Valid() bool {
+	for _, row := range r.Rows {
+		if !row.Valid() {
+			return false
+		}
+	}
+	return true
+}
+
+// ErrorCount returns the number of rows with errors
+func (r *Report) ErrorCount() int {
+	count := 0
+	for _, row := range r.Rows {
+		if !row.Valid() {
+			count++
+		}
+	}
+	return count
+}
+
+// FileError reports an import file that can't be read as reservations at all,
+// as opposed to a database error while checking or committing it
+type FileError struct {
+	Err error
+}
+
+func (e *FileError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// Run reads and validates the csv in rd, and inserts every row in one
+// transaction when commit is true and the whole file is valid. A file that
+// can't be read is reported as a *FileError
+func Run(db repository.DatabaseRepo, rd io.Reader, commit bool) (*Report, error) {
+	rows, err := parse(rd)
+	if err != nil {
+		return nil, &FileError{Err: err}
+	}
+
+	rooms, err := db.GetAllRooms()
+	if err != nil {
+		return nil, err
+	}
+
+	roomIds := make(map[int]bool)
+	for _, room := range rooms {
+		roomIds[room.ID] = true
+	}
+
+	for i := range rows {
+		row := &rows[i]
+		if !row.Valid() {
+			continue
+		}
+
+		if !roomIds[row.Reservation.RoomID] {
+			row.Form.Errors.Add("room_id", "Room does not exist")
+			continue
+		}
+
+		available, err := db.SearchAvailabilityByDateByRoomId(row.Reservation.StartDate, row.Reservation.EndDate, row.Reservation.RoomID)
+		if err != nil {
+			return nil, err
+		}
+		if !available {
+			row.Form.Errors.Add("start_date", "Dates overlap an existing reservation or block")
+			continue
+		}
+
+		// rows in the same file may not overlap each other either
+		for _, other := range rows[:i] {
+			if other.Valid() && overlaps(*row, other) {
+				row.Form.Errors.Add("start_date", "Dates overlap line %d", other.Line)
+				break
+			}
+		}
+	}
+
+	report := &Report{Rows: rows}
+
+	if !commit || !report.Valid() {
+		return report, nil
+	}
+
+	var reservations []models.Reservation
+	var blocks []models.RoomRestriction
+
+	for _, row := range rows {
+		if row.Kind == KindBlock {
+			blocks = append(blocks, models.RoomRestriction{
+				StartDate:     row.Reservation.StartDate,
+				EndDate:       row.Reservation.EndDate,
+				RoomID:        row.Reservation.RoomID,
+				RestrictionID: models.RestrictionOwnerBlock,
+			})
+		} else {
+			reservations = append(reservations, row.Reservation)
+		}
+	}
+
+	err = db.ImportReservationsAndBlocks(reservations, blocks)
+	if err != nil {
+		return report, err
+	}
+
+	report.Committed = true
+
+	return report, nil
+}
+
+func overlaps(a, b Row) bool {
+	return a.Reservation.RoomID == b.Reservation.RoomID &&
+		a.Reservation.StartDate.Before(b.Reservation.EndDate) &&
+		a.Reservation.EndDate.After(b.Reservation.StartDate)
+}
+
+// parse reads every csv record and applies the form rules to it
+func parse(rd io.Reader) ([]Row, error) {
+	reader := csv.NewReader(rd)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("import file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int)
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, required := range []string{"type", "start_date", "end_date", "room_id"} {
+		if _, ok := index[required]; !ok {
+			return nil, fmt.Errorf("import file is missing the %s column", required)
+		}
+	}
+
+	var rows []Row
+	line := 1
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return nil, err
+		}
+
+		values := url.Values{}
+		for name, i := range index {
+			if i < len(record) {
+				values.Set(name, strings.TrimSpace(record[i]))
+			}
+		}
+
+		rows = append(rows, validate(line, values))
+	}
+
+	return rows, nil
+}
+
+// validate applies the same rules used by the booking forms to a single row
+func validate(line int, values url.Values) Row {
+	form := forms.New(values)
+	row := Row{Line: line, Form: form}
+
+	switch strings.ToLower(form.Get("type")) {
+	case KindReservation:
+		row.Kind = KindReservation
+		form.Required("first_name", "last_name", "email")
+		form.MinLength("first_name", 3)
+		form.IsEmail("email")
+	case KindBlock, "owner block":
+		row.Kind = KindBlock
+	default:
+		form.Errors.Add("type", "Type must be reservation or block")
+	}
+
+	form.Required("start_date", "end_date", "room_id")
+
+	form.DateRange("start_date", "end_date", dates.Layout)
+	form.IsInt("room_id")
+
+	if form.Get("processed") != "" {
+		form.IsInt("processed")
+	}
+
+	if !form.Valid() {
+		return row
+	}
+
+	startDate, _ := dates.Parse(form.Get("start_date"))
+	endDate, _ := dates.Parse(form.Get("end_date"))
+	roomId, _ := strconv.Atoi(form.Get("room_id"))
+	processed, _ := strconv.Atoi(form.Get("processed"))
+
+	row.Reservation = models.Reservation{
+		FirstName: form.Get("first_name"),
+		LastName:  form.Get("last_name"),
+		Email:     form.Get("email"),
+		Phone:     form.Get("phone"),
+		StartDate: startDate,
+		EndDate:   endDate,
+		RoomID:    roomId,
+		Processed: processed,
+	}
+
+	return row
+}
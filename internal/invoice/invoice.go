@@ -0,0 +1,157 @@
+package invoice
+
+import (
+	"fmt"
+	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/chelobotix/booking-go/internal/pricing"
+	"github.com/chelobotix/booking-go/internal/render"
+	"io"
+	"time"
+)
+
+// ContentType is the mime type of the documents written by Write
+const ContentType = "application/pdf"
+
+// Document is an invoice to print, with what it bills in its content
+type Document struct {
+	Invoice models.Invoice
+	// TimeZone is the property's, the one issue and payment days are counted in
+	TimeZone *time.Location
+}
+
+// Number formats an invoice number
+func Number(inv models.Invoice) string {
+	return fmt.Sprintf("INV-%06d", inv.Number)
+}
+
+// FileName is the name of the PDF for an invoice
+func FileName(inv models.Invoice) string {
+	return Number(inv) + ".pdf"
+}
+
+// IncludedTax returns the tax contained in a tax-inclusive amount, rounded half up to the cent
+func IncludedTax(amount, percent int) int {
+	if percent <= 0 {
+		return 0
+	}
+	return (amount*percent*2 + 100 + percent) / (2 * (100 + percent))
+}
+
+// layout of the page
+const (
+	left       = 50.0
+	right      = pageWidth - 50
+	amountCol  = right
+	bottom     = pageHeight - 60
+	lineHeight = 16.0
+)
+
+// Write writes the invoice as a PDF
+func Write(w io.Writer, doc Document) error {
+	content := doc.Invoice.Content
+	res := content.Reservation
+	pdf := &document{}
+	pdf.addPage()
+
+	y := 60.0
+	next := func(step float64) {
+		y += step
+		if y > bottom {
+			pdf.addPage()
+			y = 60
+		}
+	}
+
+	pdf.text(left, y, 18, true, content.Property)
+	pdf.textRight(right, y, 18, true, "INVOICE")
+	next(24)
+	pdf.text(left, y, 10, false, "Invoice "+Number(doc.Invoice))
+	pdf.textRight(right, y, 10, false, "Issued "+doc.Invoice.IssuedAt.In(doc.TimeZone).Format("2006-01-02"))
+	next(lineHeight)
+	if res.Booking.Confirmation != "" {
+		pdf.text(left, y, 10, false, "Booking "+res.Booking.Confirmation)
+		next(lineHeight)
+	}
+	pdf.text(left, y, 10, false, fmt.Sprintf("Reservation #%d", res.ID))
+	next(2 * lineHeight)
+
+	pdf.text(left, y, 11, true, "Billed to")
+	pdf.text(300, y, 11, true, "Stay")
+	next(lineHeight)
+	pdf.text(left, y, 10, false, res.FirstName+" "+res.LastName)
+	pdf.text(300, y, 10, false, res.Room.RoomName)
+	next(lineHeight)
+	pdf.text(left, y, 10, false, res.Email)
+	pdf.text(300, y, 10, false, fmt.Sprintf("%s to %s", res.StartDate.Format("2006-01-02"), res.EndDate.Format("2006-01-02")))
+	next(lineHeight)
+	pdf.text(left, y, 10, false, res.Phone)
+	pdf.text(300, y, 10, false, fmt.Sprintf("%d adults, %d children", res.Adults, res.Children))
+	next(2 * lineHeight)
+
+	pdf.text(left, y, 10, true, "Night")
+	pdf.text(200, y, 10, true, "Description")
+	pdf.textRight(amountCol, y, 10, true, "Amount")
+	next(6)
+	pdf.line(left, y, right, y)
+	next(lineHeight)
+
+	for _, line := range content.Lines {
+		pdf.text(left, y, 10, false, line.Date.Format("Mon 2006-01-02"))
+		pdf.text(200, y, 10, false, line.Description)
+		pdf.textRight(amountCol, y, 10, false, render.Money(line.Amount))
+		next(lineHeight)
+	}
+
+	pdf.line(left, y-10, right, y-10)
+	next(4)
+
+	total := func(label string, amount int, bold bool) {
+		pdf.text(300, y, 10, bold, label)
+		pdf.textRight(amountCol, y, 10, bold, render.Money(amount))
+		next(lineHeight)
+	}
+
+	total("Subtotal", res.Subtotal, false)
+	if res.Discount > 0 {
+		total("Discount ("+res.PromoCode+")", -res.Discount, false)
+	}
+	total("Total", res.Total, true)
+	if content.TaxPercent > 0 {
+		total(fmt.Sprintf("Includes tax (%d%%)", content.TaxPercent), IncludedTax(res.Total, content.TaxPercent), false)
+	}
+	next(lineHeight)
+
+	if len(content.Payments) > 0 {
+		pdf.text(left, y, 11, true, "Payments")
+		next(lineHeight)
+		for _, p := range content.Payments {
+			amount := p.Amount
+			if p.Kind == models.PaymentRefund {
+				amount = -amount
+			}
+			pdf.text(left, y, 10, false, p.CreatedAt.In(doc.TimeZone).Format("2006-01-02"))
+			pdf.text(130, y, 10, false, p.Description)
+			pdf.text(300, y, 9, false, p.Reference)
+			pdf.textRight(amountCol, y, 10, false, render.Money(amount))
+			next(lineHeight)
+		}
+		next(4)
+	}
+
+	total("Paid", res.Paid, false)
+	total("Balance due", res.Balance(), true)
+	next(lineHeight)
+
+	if res.CancellationPolicy.ID > 0 {
+		pdf.text(left, y, 11, true, "Cancellation")
+		next(lineHeight)
+		pdf.text(left, y, 9, false, pricing.PolicyTerms(res.CancellationPolicy).String())
+		next(lineHeight)
+		if res.CancellationPolicy.Description != "" {
+			pdf.text(left, y, 9, false, res.CancellationPolicy.Description)
+			next(lineHeight)
+		}
+	}
+
+	return pdf.writeTo(w)
+}
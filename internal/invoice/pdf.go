@@ -0,0 +1,132 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A4 page size in points
+const (
+	pageWidth  = 595.0
+	pageHeight = 842.0
+)
+
+// document is a minimal PDF writer for text and lines in the standard Helvetica fonts,
+// which every reader has so nothing needs embedding. Coordinates are in points from the top left
+type document struct {
+	pages []*bytes.Buffer
+}
+
+// addPage starts a new page, later drawing goes on it
+func (d *document) addPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+}
+
+// page returns the content stream of the current page
+func (d *document) page() *bytes.Buffer {
+	if len(d.pages) == 0 {
+		d.addPage()
+	}
+	return d.pages[len(d.pages)-1]
+}
+
+// text writes s with its baseline at y
+func (d *document) text(x, y, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(d.page(), "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, pageHeight-y, escape(s))
+}
+
+// textRight writes s ending at x
+func (d *document) textRight(x, y, size float64, bold bool, s string) {
+	d.text(x-width(s, size), y, size, bold, s)
+}
+
+// line draws a thin line
+func (d *document) line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(d.page(), "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, pageHeight-y1, x2, pageHeight-y2)
+}
+
+// writeTo writes the document as a PDF file
+func (d *document) writeTo(w io.Writer) error {
+	d.page()
+
+	var out bytes.Buffer
+	var offsets []int
+
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+
+	// 1 catalog, 2 page tree, 3 and 4 fonts, then a page and its content stream for each page
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, content := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", pageWidth, pageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// escape encodes s as a PDF string body, characters outside Latin-1 become ?
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32:
+			b.WriteByte(' ')
+		case r < 128:
+			b.WriteRune(r)
+		case r < 256:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// width is the width of s in Helvetica at size. Only the characters used in amounts are
+// measured exactly, which is all right-aligned text needs
+func width(s string, size float64) float64 {
+	var units int
+	for _, r := range s {
+		switch r {
+		case '.', ',', ' ':
+			units += 278
+		case '-':
+			units += 333
+		default:
+			units += 556
+		}
+	}
+	return float64(units) * size / 1000
+}
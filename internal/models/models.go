@@ -1,6 +1,7 @@
 package models
 
 import (
+	"github.com/chelobotix/booking-go/internal/dates"
 	"time"
 )
 
@@ -18,10 +19,98 @@ type User struct {
 
 // Room is the room model
 type Room struct {
-	ID        int
-	RoomName  string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID           int
+	RoomName     string
+	MaxOccupancy int
+	// Price is the nightly rate in cents
+	Price int
+	// CheckInTime and CheckOutTime are when guests may arrive from and must leave by, as 15:04
+	CheckInTime  string
+	CheckOutTime string
+	// BufferDays are blocked for cleaning after every stay
+	BufferDays int
+	// SameDayTurnover lets a guest arrive on the day another leaves
+	SameDayTurnover bool
+	// Status is where housekeeping is with the room, StatusNote why, such as what is broken
+	Status          string
+	StatusNote      string
+	StatusUpdatedAt time.Time
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// Room statuses kept by housekeeping. Out of order rooms can't be booked
+const (
+	RoomDirty      = "dirty"
+	RoomClean      = "clean"
+	RoomInspected  = "inspected"
+	RoomOutOfOrder = "out_of_order"
+)
+
+// RoomStatuses are the room statuses in the order housekeeping moves rooms through them
+var RoomStatuses = []string{RoomDirty, RoomClean, RoomInspected, RoomOutOfOrder}
+
+// Ready reports whether the room can be given to an arriving guest
+func (r Room) Ready() bool {
+	return r.Status == RoomClean || r.Status == RoomInspected
+}
+
+// TurnoverGap is how many days a stay or block keeps the room empty before and after it: the
+// cleaning buffer, or a day when guests can't arrive on the day others leave. Availability
+// queries apply the same rule
+func (r Room) TurnoverGap() int {
+	if r.SameDayTurnover {
+		return r.BufferDays
+	}
+	return max(r.BufferDays, 1)
+}
+
+// HousekeepingTask is what a room needs on a day: cleaning after the guest leaving, getting ready
+// for the guest arriving, or both when one follows the other. Reservations have ID 0 when nobody
+// leaves or arrives
+type HousekeepingTask struct {
+	Day       dates.Date
+	Room      Room
+	Departure Reservation
+	Arrival   Reservation
+	// Cleaning is set while the room is blocked for its cleaning buffer
+	Cleaning bool
+	// Departed is when the departing guest left: their check-out, or the start of Day at the
+	// property when they weren't checked out at the front desk
+	Departed time.Time
+}
+
+// DepartureCleaned reports whether housekeeping has marked the room clean or inspected since the
+// departing guest left, always true when nobody leaves
+func (t HousekeepingTask) DepartureCleaned() bool {
+	if t.Departure.ID == 0 {
+		return true
+	}
+	return t.Room.Ready() && !t.Room.StatusUpdatedAt.Before(t.Departed)
+}
+
+// Turnover reports whether a guest arrives in the room the day another leaves it
+func (t HousekeepingTask) Turnover() bool {
+	return t.Departure.ID > 0 && t.Arrival.ID > 0
+}
+
+// Task says what housekeeping has to do in the room, nothing when it needs no work that day
+func (t HousekeepingTask) Task() string {
+	switch {
+	case t.Turnover() && !t.DepartureCleaned():
+		return "Turnover: clean after departure, ready for arrival"
+	case !t.DepartureCleaned():
+		return "Departure clean"
+	case t.Arrival.ID > 0 && !t.Room.Ready():
+		return "Clean before arrival"
+	case t.Arrival.ID > 0 && t.Room.Status != RoomInspected:
+		return "Inspect before arrival"
+	case t.Cleaning && !t.Room.Ready():
+		return "Cleaning buffer day"
+	case t.Room.Status == RoomDirty:
+		return "Clean"
+	}
+	return ""
 }
 
 // Restriction is the restriction model
@@ -39,23 +128,123 @@ type Reservation struct {
 	LastName  string
 	Email     string
 	Phone     string
-	StartDate time.Time
-	EndDate   time.Time
+	StartDate dates.Date
+	EndDate   dates.Date
 	RoomID    int
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Room      Room
 	Processed int
+	DeletedAt time.Time
+	BookingID int
+	Booking   Booking
+	Adults    int
+	Children  int
+	// prices are in cents, Total is Subtotal less Discount
+	Subtotal    int
+	Discount    int
+	Total       int
+	PromoCodeID int
+	PromoCode   string
+	// GuestID is the guest profile the reservation belongs to, matched by email
+	GuestID int
+	// CancellationPolicy is the policy the reservation was booked under
+	CancellationPolicyID int
+	CancellationPolicy   CancellationPolicy
+	// Paid is what has been charged less what has been refunded, read from the payments
+	Paid int
+	// Payments are recorded together with the reservation when it is inserted, e.g. the deposit
+	Payments []Payment
+	// HoldID is the room_restrictions hold placed while the guest checks out, it is not stored
+	HoldID int
+	// Currency is what the guest was charged in, with the rate of the day they booked
+	Currency Currency
+	// IDType and IDNumber are the identity document the front desk saw at check-in, ArrivedAt when
+	// the guest actually arrived and FrontDeskNotes anything staff noted. The other times are when
+	// the front desk checked the guest in and out and last extended the stay
+	IDType         string
+	IDNumber       string
+	ArrivedAt      time.Time
+	CheckedInAt    time.Time
+	CheckedOutAt   time.Time
+	ExtendedAt     time.Time
+	FrontDeskNotes string
 }
 
+// InHouse reports whether the guest has checked in and not yet checked out
+func (r Reservation) InHouse() bool {
+	return !r.CheckedInAt.IsZero() && r.CheckedOutAt.IsZero()
+}
+
+// Guests returns the total number of guests on the reservation
+func (r Reservation) Guests() int {
+	return r.Adults + r.Children
+}
+
+// Balance returns what the guest still owes
+func (r Reservation) Balance() int {
+	return r.Total - r.Paid
+}
+
+// PaymentStatus describes how much of the reservation has been paid
+func (r Reservation) PaymentStatus() string {
+	switch {
+	case r.Paid <= 0:
+		return "Unpaid"
+	case r.Paid < r.Total:
+		return "Partly paid"
+	default:
+		return "Paid in full"
+	}
+}
+
+// Guest is a person who has booked, one per email address. Stays and LastStay count
+// the guest's reservations that haven't been deleted. HasAccount is set once the guest
+// registered a password for the public site
+type Guest struct {
+	ID          int
+	FirstName   string
+	LastName    string
+	Email       string
+	Phone       string
+	Notes       string
+	Preferences string
+	HasAccount  bool
+	// EmailVerifiedAt is when the guest confirmed they own Email, zero until then
+	EmailVerifiedAt time.Time
+	// VerifyExpiresAt is when the link sent to confirm Email stops working, zero when none was sent
+	VerifyExpiresAt time.Time
+	Stays           int
+	LastStay        dates.Date
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// Booking groups the reservations made together under one confirmation number
+type Booking struct {
+	ID           int
+	Confirmation string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// Restriction ids seeded in the restrictions table
+const (
+	RestrictionReservation = 1
+	RestrictionOwnerBlock  = 2
+	RestrictionHold        = 3
+	RestrictionCleaning    = 4
+)
+
 // RoomRestriction is the room restriction model
 type RoomRestriction struct {
 	ID            int
-	StartDate     time.Time
-	EndDate       time.Time
+	StartDate     dates.Date
+	EndDate       dates.Date
 	RoomID        int
 	ReservationID int
 	RestrictionID int
+	ExpiresAt     time.Time
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 	Room          Room
@@ -63,11 +252,263 @@ type RoomRestriction struct {
 	Restriction   Restriction
 }
 
+// BookingRule limits which stays can be booked. RoomID 0 applies to every room and a zero
+// season applies all year, zero limits are not enforced
+type BookingRule struct {
+	ID              int
+	Name            string
+	RoomID          int
+	SeasonStart     dates.Date
+	SeasonEnd       dates.Date
+	MinNights       int
+	MaxNights       int
+	MinNoticeHours  int
+	MaxHorizonDays  int
+	NoArrivalDays   []time.Weekday
+	NoDepartureDays []time.Weekday
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Room            Room
+}
+
+// Promo code kinds
+const (
+	PromoPercent = "percent"
+	PromoFixed   = "fixed"
+)
+
+// PromoCode is a discount guests enter when booking. Amount is a percentage or, for fixed
+// codes, cents off the stay. Empty RoomIDs, zero dates and zero limits mean no restriction
+type PromoCode struct {
+	ID          int
+	Code        string
+	Description string
+	Kind        string
+	Amount      int
+	ValidFrom   dates.Date
+	ValidTo     dates.Date
+	RoomIDs     []int
+	MinNights   int
+	MaxUses     int
+	Uses        int
+	Active      bool
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Cancellation penalty kinds
+const (
+	PenaltyPercent    = "percent"
+	PenaltyFirstNight = "first_night"
+)
+
+// CancellationPolicy sets what a guest pays for cancelling. Cancelling at least FreeDays before
+// arrival is free, after that PenaltyAmount percent of the total or the first night is charged.
+// A policy without a room applies to every room that has none of its own
+type CancellationPolicy struct {
+	ID            int
+	Name          string
+	Description   string
+	RoomID        int
+	Room          Room
+	FreeDays      int
+	PenaltyKind   string
+	PenaltyAmount int
+	Active        bool
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// Currency is a currency prices are shown and charged in. Rate is how much of it one unit of the
+// base currency buys. Amounts are rounded to Decimals places, then to the nearest RoundTo of the
+// smallest unit, such as 5 for Swiss francs which are paid to the 5 cents
+type Currency struct {
+	ID        int
+	Code      string
+	Symbol    string
+	Rate      float64
+	Decimals  int
+	RoundTo   int
+	Active    bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Payment kinds
+const (
+	PaymentCharge = "charge"
+	PaymentRefund = "refund"
+)
+
+// Payment is money taken for or given back on a reservation, in cents. Reference is the
+// gateway's transaction id and RefundOf the charge a refund gives money back from
+type Payment struct {
+	ID            int
+	ReservationID int
+	Kind          string
+	Amount        int
+	Description   string
+	Reference     string
+	RefundOf      int
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// Invoice is the numbered document issued for a reservation. Numbers run without gaps in the
+// order invoices are issued
+type Invoice struct {
+	ID            int
+	ReservationID int
+	Number        int
+	IssuedAt      time.Time
+	Content       InvoiceContent
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// InvoiceContent is what an invoice bills, copied from its reservation when the number is issued so
+// later changes to the stay, prices, payments or tax leave an invoice already sent as it was
+type InvoiceContent struct {
+	Property    string
+	TaxPercent  int
+	Reservation Reservation
+	Lines       []InvoiceLine
+	Payments    []Payment
+}
+
+// InvoiceLine is a night billed on an invoice
+type InvoiceLine struct {
+	Date        dates.Date
+	Description string
+	Amount      int
+}
+
+// AvailableWindow is a stay a room is free for, found by a flexible-date search
+type AvailableWindow struct {
+	Room      Room
+	StartDate dates.Date
+	EndDate   dates.Date
+}
+
+// Waitlist entry statuses
+const (
+	WaitlistWaiting = "waiting"
+	WaitlistOffered = "offered"
+	WaitlistBooked  = "booked"
+	WaitlistExpired = "expired"
+)
+
+// WaitlistEntry is a guest waiting for dates to free up, RoomID 0 means any room that fits.
+// Locale is the language the guest joined in, which their offer is emailed in
+type WaitlistEntry struct {
+	ID             int
+	FirstName      string
+	LastName       string
+	Email          string
+	StartDate      dates.Date
+	EndDate        dates.Date
+	RoomID         int
+	Adults         int
+	Children       int
+	Status         string
+	Token          string
+	HoldID         int
+	OfferedRoomID  int
+	OfferExpiresAt time.Time
+	Locale         string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	Room           Room
+	OfferedRoom    Room
+}
+
+// Actor is whoever performed a write, a staff user or a guest identified by their session
+type Actor struct {
+	UserID     int
+	GuestToken string
+	IP         string
+}
+
+// Type returns user, guest or system
+func (a Actor) Type() string {
+	switch {
+	case a.UserID > 0:
+		return "user"
+	case a.GuestToken != "":
+		return "guest"
+	default:
+		return "system"
+	}
+}
+
+// AuditLog is the audit log model
+type AuditLog struct {
+	ID         int
+	ActorType  string
+	UserID     int
+	GuestToken string
+	Action     string
+	Entity     string
+	EntityID   int
+	Changes    string
+	IP         string
+	CreatedAt  time.Time
+	User       User
+}
+
+// AuditFilter narrows the audit trail returned by the repository
+type AuditFilter struct {
+	Entity   string
+	EntityID int
+	Action   string
+	UserID   int
+	Page     int
+	PerPage  int
+}
+
 // MailData struct for email
 type MailData struct {
-	To       string
-	From     string
-	Subject  string
-	Content  string
-	Template string
+	To          string
+	From        string
+	Subject     string
+	Content     string
+	Template    string
+	Attachments []MailAttachment
+}
+
+// MailAttachment is a file sent with an email
+type MailAttachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Reservation statuses used when filtering
+const (
+	StatusNew       = "new"
+	StatusProcessed = "processed"
+)
+
+// Reservation sort columns
+const (
+	SortStartDate = "start_date"
+	SortCreatedAt = "created_at"
+)
+
+// DefaultPerPage is the page size used when a filter does not set one
+const DefaultPerPage = 20
+
+// ReservationFilter narrows, sorts and pages the reservations returned by the
+// repository, zero values mean no filtering on that field
+type ReservationFilter struct {
+	StartDate  dates.Date
+	EndDate    dates.Date
+	RoomID     int
+	Status     string
+	Search     string
+	Sort       string
+	Descending bool
+	Trashed    bool
+	Page       int
+	PerPage    int
 }
@@ -13,4 +13,13 @@ type TemplateData struct {
 	Error           string
 	Form            *forms.Form
 	IsAuthenticated int
+	IsGuest         int
+	// Locale is the language the page is shown in, Locales the ones it can be switched to
+	Locale  string
+	Locales []string
+	// Path is the page's address without a language prefix
+	Path string
+	// Currency is the currency prices are shown in, Currencies the ones the guest can pick
+	Currency   Currency
+	Currencies []Currency
 }
@@ -0,0 +1,29 @@
+package payments
+
+import (
+	"errors"
+)
+
+// ErrDeclined is returned by a gateway when the card can't be charged
+var ErrDeclined = errors.New("card declined")
+
+// Card holds the card details entered by the guest. They are passed to the gateway and never stored
+type Card struct {
+	Name   string
+	Number string
+	Expiry string
+	CVC    string
+}
+
+// Gateway takes and gives back card payments. Amounts are in the smallest unit of the currency,
+// a refund is in the currency of its charge, and the returned string is the gateway's reference
+// for the transaction
+type Gateway interface {
+	Charge(card Card, amount int, currency, description string) (string, error)
+	Refund(reference string, amount int) (string, error)
+}
+
+// Deposit returns the part of total taken at booking, percent rounded half up to the cent
+func Deposit(total, percent int) int {
+	return min((total*percent+50)/100, total)
+}
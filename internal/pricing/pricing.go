@@ -0,0 +1,155 @@
+package pricing
+
+import (
+	"github.com/chelobotix/booking-go/internal/dates"
+	"github.com/chelobotix/booking-go/internal/i18n"
+	"github.com/chelobotix/booking-go/internal/models"
+	"strings"
+	"time"
+)
+
+// Nights returns the number of nights between two dates
+func Nights(start, end dates.Date) int {
+	return end.Sub(start)
+}
+
+// NightlyRates spreads a reservation's subtotal over its nights, the last night takes any odd cents
+func NightlyRates(res models.Reservation) []int {
+	nights := Nights(res.StartDate, res.EndDate)
+	if nights <= 0 {
+		return nil
+	}
+
+	rates := make([]int, nights)
+	for i := range rates {
+		rates[i] = res.Subtotal / nights
+	}
+	rates[nights-1] = res.Subtotal - rates[0]*(nights-1)
+
+	return rates
+}
+
+// Discount returns the cents a promo code takes off subtotal, never more than subtotal
+func Discount(promo models.PromoCode, subtotal int) int {
+	var discount int
+
+	switch promo.Kind {
+	case models.PromoPercent:
+		// round half up to the cent
+		discount = (subtotal*promo.Amount + 50) / 100
+	case models.PromoFixed:
+		discount = promo.Amount
+	}
+
+	return min(max(discount, 0), subtotal)
+}
+
+// Apply prices the reservation for room, with the promo code when it is not nil
+func Apply(res *models.Reservation, room models.Room, promo *models.PromoCode) {
+	res.Subtotal = Nights(res.StartDate, res.EndDate) * room.Price
+	res.Discount = 0
+	res.PromoCodeID = 0
+	res.PromoCode = ""
+
+	if promo != nil {
+		res.Discount = Discount(*promo, res.Subtotal)
+		res.PromoCodeID = promo.ID
+		res.PromoCode = promo.Code
+	}
+
+	res.Total = res.Subtotal - res.Discount
+}
+
+// Extend moves the departure of res to end and charges the added nights at room's rate. What was
+// already booked keeps its price, promo code and discount
+func Extend(res *models.Reservation, room models.Room, end dates.Date) {
+	added := Nights(res.EndDate, end) * room.Price
+
+	res.EndDate = end
+	res.Subtotal += added
+	res.Total += added
+}
+
+// NormalizeCode is how codes are stored and looked up, so guests don't need to match case
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// CheckPromo returns a message saying why the promo code can't be used on a stay in roomId
+// booked at now, or the zero Message when it can. now is in the property's time zone
+func CheckPromo(promo models.PromoCode, roomId int, start, end dates.Date, now time.Time) i18n.Message {
+	today := dates.Of(now)
+
+	if !promo.Active {
+		return i18n.M("This code is no longer valid")
+	}
+	if !promo.ValidFrom.IsZero() && today.Before(promo.ValidFrom) {
+		return i18n.M("This code is not valid yet")
+	}
+	if !promo.ValidTo.IsZero() && today.After(promo.ValidTo) {
+		return i18n.M("This code has expired")
+	}
+	if promo.MaxUses > 0 && promo.Uses >= promo.MaxUses {
+		return i18n.M("This code has been used up")
+	}
+	if promo.MinNights > 0 && Nights(start, end) < promo.MinNights {
+		return i18n.M("This code needs a stay of at least %d nights", promo.MinNights)
+	}
+
+	if len(promo.RoomIDs) > 0 {
+		for _, id := range promo.RoomIDs {
+			if id == roomId {
+				return i18n.Message{}
+			}
+		}
+		return i18n.M("This code can't be used for this room")
+	}
+
+	return i18n.Message{}
+}
+
+// Penalty returns the cents charged for cancelling res at now under policy. now is in the
+// property's time zone, cancelling is free until midnight there FreeDays before arrival
+func Penalty(policy models.CancellationPolicy, res models.Reservation, now time.Time) int {
+	if policy.ID == 0 || now.Before(res.StartDate.AddDays(-policy.FreeDays).In(now.Location())) {
+		return 0
+	}
+
+	var penalty int
+
+	switch policy.PenaltyKind {
+	case models.PenaltyPercent:
+		penalty = (res.Total*policy.PenaltyAmount + 50) / 100
+	case models.PenaltyFirstNight:
+		if nights := Nights(res.StartDate, res.EndDate); nights > 0 {
+			penalty = res.Subtotal / nights
+		}
+	}
+
+	return min(max(penalty, 0), res.Total)
+}
+
+// PolicyTerms describes a cancellation policy to guests
+func PolicyTerms(policy models.CancellationPolicy) i18n.Message {
+	var penalty i18n.Message
+
+	switch policy.PenaltyKind {
+	case models.PenaltyPercent:
+		penalty = i18n.M("%d%% of the total is charged", policy.PenaltyAmount)
+	case models.PenaltyFirstNight:
+		penalty = i18n.M("the first night is charged")
+	default:
+		return i18n.M("Free cancellation")
+	}
+
+	if policy.FreeDays <= 0 {
+		return i18n.M("Cancelling %s", penalty)
+	}
+
+	day := i18n.M("days")
+	if policy.FreeDays == 1 {
+		day = i18n.M("day")
+	}
+
+	return i18n.M("Free cancellation until %d %s before arrival, after that %s", policy.FreeDays, day, penalty)
+}
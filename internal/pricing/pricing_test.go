@@ -0,0 +1,258 @@
+package pricing
+
+import (
+	"github.com/chelobotix/booking-go/internal/dates"
+	"github.com/chelobotix/booking-go/internal/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNights(t *testing.T) {
+	tests := []struct {
+		start, end dates.Date
+		want       int
+	}{
+		{dates.New(2024, 3, 10), dates.New(2024, 3, 10), 0},
+		{dates.New(2024, 3, 10), dates.New(2024, 3, 11), 1},
+		{dates.New(2024, 2, 27), dates.New(2024, 3, 2), 4},
+		{dates.New(2024, 12, 30), dates.New(2025, 1, 2), 3},
+	}
+
+	for _, tt := range tests {
+		if got := Nights(tt.start, tt.end); got != tt.want {
+			t.Errorf("Nights(%s, %s) = %d, want %d", tt.start, tt.end, got, tt.want)
+		}
+	}
+}
+
+func TestNightlyRates(t *testing.T) {
+	tests := []struct {
+		subtotal   int
+		start, end dates.Date
+		want       []int
+	}{
+		{30000, dates.New(2024, 3, 10), dates.New(2024, 3, 13), []int{10000, 10000, 10000}},
+		{10001, dates.New(2024, 3, 10), dates.New(2024, 3, 13), []int{3333, 3333, 3335}},
+		{5000, dates.New(2024, 3, 10), dates.New(2024, 3, 11), []int{5000}},
+		{5000, dates.New(2024, 3, 10), dates.New(2024, 3, 10), nil},
+	}
+
+	for _, tt := range tests {
+		res := models.Reservation{StartDate: tt.start, EndDate: tt.end, Subtotal: tt.subtotal}
+		if got := NightlyRates(res); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("NightlyRates(%d from %s to %s) = %v, want %v", tt.subtotal, tt.start, tt.end, got, tt.want)
+		}
+	}
+}
+
+func TestDiscount(t *testing.T) {
+	tests := []struct {
+		name     string
+		promo    models.PromoCode
+		subtotal int
+		want     int
+	}{
+		{"percent", models.PromoCode{Kind: models.PromoPercent, Amount: 10}, 30000, 3000},
+		{"percent rounds half up", models.PromoCode{Kind: models.PromoPercent, Amount: 15}, 1010, 152},
+		{"percent rounds down", models.PromoCode{Kind: models.PromoPercent, Amount: 15}, 1003, 150},
+		{"fixed", models.PromoCode{Kind: models.PromoFixed, Amount: 2500}, 30000, 2500},
+		{"fixed above the subtotal", models.PromoCode{Kind: models.PromoFixed, Amount: 50000}, 30000, 30000},
+		{"more than all of it", models.PromoCode{Kind: models.PromoPercent, Amount: 150}, 30000, 30000},
+		{"negative", models.PromoCode{Kind: models.PromoFixed, Amount: -500}, 30000, 0},
+		{"unknown kind", models.PromoCode{Kind: "bogus", Amount: 10}, 30000, 0},
+	}
+
+	for _, tt := range tests {
+		if got := Discount(tt.promo, tt.subtotal); got != tt.want {
+			t.Errorf("%s: Discount() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	room := models.Room{ID: 1, Price: 10000}
+	promo := models.PromoCode{ID: 7, Code: "SPRING", Kind: models.PromoPercent, Amount: 20}
+
+	tests := []struct {
+		name  string
+		res   models.Reservation
+		promo *models.PromoCode
+		want  models.Reservation
+	}{
+		{
+			name:  "no promo",
+			res:   models.Reservation{StartDate: dates.New(2024, 3, 10), EndDate: dates.New(2024, 3, 13)},
+			promo: nil,
+			want:  models.Reservation{StartDate: dates.New(2024, 3, 10), EndDate: dates.New(2024, 3, 13), Subtotal: 30000, Total: 30000},
+		},
+		{
+			name:  "promo",
+			res:   models.Reservation{StartDate: dates.New(2024, 3, 10), EndDate: dates.New(2024, 3, 13)},
+			promo: &promo,
+			want: models.Reservation{StartDate: dates.New(2024, 3, 10), EndDate: dates.New(2024, 3, 13), Subtotal: 30000, Discount: 6000, Total: 24000,
+				PromoCodeID: 7, PromoCode: "SPRING"},
+		},
+		{
+			name: "promo dropped",
+			res: models.Reservation{StartDate: dates.New(2024, 3, 10), EndDate: dates.New(2024, 3, 12), Subtotal: 30000, Discount: 6000, Total: 24000,
+				PromoCodeID: 7, PromoCode: "SPRING"},
+			promo: nil,
+			want:  models.Reservation{StartDate: dates.New(2024, 3, 10), EndDate: dates.New(2024, 3, 12), Subtotal: 20000, Total: 20000},
+		},
+	}
+
+	for _, tt := range tests {
+		got := tt.res
+		Apply(&got, room, tt.promo)
+
+		if got.Subtotal != tt.want.Subtotal || got.Discount != tt.want.Discount || got.Total != tt.want.Total ||
+			got.PromoCodeID != tt.want.PromoCodeID || got.PromoCode != tt.want.PromoCode {
+			t.Errorf("%s: Apply() gave subtotal %d, discount %d, total %d, promo %d %q, want %d, %d, %d, %d %q", tt.name,
+				got.Subtotal, got.Discount, got.Total, got.PromoCodeID, got.PromoCode,
+				tt.want.Subtotal, tt.want.Discount, tt.want.Total, tt.want.PromoCodeID, tt.want.PromoCode)
+		}
+	}
+}
+
+func TestExtend(t *testing.T) {
+	room := models.Room{ID: 1, Price: 12000}
+
+	// three nights at an older rate of 100.00 with 20% off
+	res := models.Reservation{
+		StartDate:   dates.New(2024, 3, 10),
+		EndDate:     dates.New(2024, 3, 13),
+		Subtotal:    30000,
+		Discount:    6000,
+		Total:       24000,
+		PromoCodeID: 7,
+		PromoCode:   "SPRING",
+	}
+
+	Extend(&res, room, dates.New(2024, 3, 15))
+
+	if res.EndDate != dates.New(2024, 3, 15) {
+		t.Errorf("EndDate = %s, want 2024-03-15", res.EndDate)
+	}
+	if res.Subtotal != 54000 || res.Total != 48000 {
+		t.Errorf("subtotal %d and total %d, want 54000 and 48000", res.Subtotal, res.Total)
+	}
+	if res.Discount != 6000 || res.PromoCodeID != 7 || res.PromoCode != "SPRING" {
+		t.Errorf("discount %d and promo %d %q changed, want 6000 and 7 \"SPRING\"", res.Discount, res.PromoCodeID, res.PromoCode)
+	}
+}
+
+func TestNormalizeCode(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"spring", "SPRING"},
+		{"  Spring24 ", "SPRING24"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeCode(tt.in); got != tt.want {
+			t.Errorf("NormalizeCode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCheckPromo(t *testing.T) {
+	lima := time.FixedZone("Lima", -5*60*60)
+
+	// late on 10 March at the property, already 11 March in UTC
+	now := time.Date(2024, 3, 10, 22, 0, 0, 0, lima)
+	start, end := dates.New(2024, 4, 1), dates.New(2024, 4, 4)
+
+	valid := models.PromoCode{Active: true}
+
+	tests := []struct {
+		name   string
+		promo  func(p *models.PromoCode)
+		roomId int
+		want   string
+	}{
+		{"valid", func(p *models.PromoCode) {}, 1, ""},
+		{"inactive", func(p *models.PromoCode) { p.Active = false }, 1, "This code is no longer valid"},
+		{"starts tomorrow", func(p *models.PromoCode) { p.ValidFrom = dates.New(2024, 3, 11) }, 1, "This code is not valid yet"},
+		{"starts today", func(p *models.PromoCode) { p.ValidFrom = dates.New(2024, 3, 10) }, 1, ""},
+		{"ends today", func(p *models.PromoCode) { p.ValidTo = dates.New(2024, 3, 10) }, 1, ""},
+		{"ended yesterday", func(p *models.PromoCode) { p.ValidTo = dates.New(2024, 3, 9) }, 1, "This code has expired"},
+		{"used up", func(p *models.PromoCode) { p.MaxUses = 5; p.Uses = 5 }, 1, "This code has been used up"},
+		{"uses left", func(p *models.PromoCode) { p.MaxUses = 5; p.Uses = 4 }, 1, ""},
+		{"stay too short", func(p *models.PromoCode) { p.MinNights = 4 }, 1, "This code needs a stay of at least 4 nights"},
+		{"stay long enough", func(p *models.PromoCode) { p.MinNights = 3 }, 1, ""},
+		{"other rooms", func(p *models.PromoCode) { p.RoomIDs = []int{2, 3} }, 1, "This code can't be used for this room"},
+		{"this room", func(p *models.PromoCode) { p.RoomIDs = []int{2, 1} }, 1, ""},
+	}
+
+	for _, tt := range tests {
+		promo := valid
+		tt.promo(&promo)
+
+		if got := CheckPromo(promo, tt.roomId, start, end, now).String(); got != tt.want {
+			t.Errorf("%s: CheckPromo() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPenalty(t *testing.T) {
+	lima := time.FixedZone("Lima", -5*60*60)
+
+	// three nights from 20 March, 10% off
+	res := models.Reservation{
+		StartDate: dates.New(2024, 3, 20),
+		EndDate:   dates.New(2024, 3, 23),
+		Subtotal:  30000,
+		Discount:  3000,
+		Total:     27000,
+	}
+
+	percent := models.CancellationPolicy{ID: 1, FreeDays: 7, PenaltyKind: models.PenaltyPercent, PenaltyAmount: 50}
+	firstNight := models.CancellationPolicy{ID: 2, FreeDays: 2, PenaltyKind: models.PenaltyFirstNight}
+
+	tests := []struct {
+		name   string
+		policy models.CancellationPolicy
+		res    models.Reservation
+		now    time.Time
+		want   int
+	}{
+		{"no policy", models.CancellationPolicy{}, res, time.Date(2024, 3, 19, 12, 0, 0, 0, lima), 0},
+		{"in the free days", percent, res, time.Date(2024, 3, 12, 23, 59, 0, 0, lima), 0},
+		{"free days over at midnight", percent, res, time.Date(2024, 3, 13, 0, 0, 0, 0, lima), 13500},
+		{"percent of the total", percent, res, time.Date(2024, 3, 19, 12, 0, 0, 0, lima), 13500},
+		{"percent rounds half up", percent, models.Reservation{StartDate: res.StartDate, EndDate: res.EndDate, Total: 101}, time.Date(2024, 3, 19, 0, 0, 0, 0, lima), 51},
+		{"first night", firstNight, res, time.Date(2024, 3, 19, 12, 0, 0, 0, lima), 10000},
+		{"first night of a free stay", firstNight, models.Reservation{StartDate: res.StartDate, EndDate: res.EndDate, Subtotal: 30000, Discount: 30000}, time.Date(2024, 3, 19, 0, 0, 0, 0, lima), 0},
+		{"first night with no nights", firstNight, models.Reservation{StartDate: res.StartDate, EndDate: res.StartDate, Total: 5000}, time.Date(2024, 3, 19, 0, 0, 0, 0, lima), 0},
+		{"never more than the total", models.CancellationPolicy{ID: 3, PenaltyKind: models.PenaltyPercent, PenaltyAmount: 200}, res, time.Date(2024, 3, 20, 0, 0, 0, 0, lima), 27000},
+		{"no free days, before arrival", models.CancellationPolicy{ID: 3, PenaltyKind: models.PenaltyPercent, PenaltyAmount: 10}, res, time.Date(2024, 3, 19, 23, 59, 0, 0, lima), 0},
+		{"no free days, on arrival", models.CancellationPolicy{ID: 3, PenaltyKind: models.PenaltyPercent, PenaltyAmount: 10}, res, time.Date(2024, 3, 20, 0, 0, 0, 0, lima), 2700},
+	}
+
+	for _, tt := range tests {
+		if got := Penalty(tt.policy, tt.res, tt.now); got != tt.want {
+			t.Errorf("%s: Penalty() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyTerms(t *testing.T) {
+	tests := []struct {
+		policy models.CancellationPolicy
+		want   string
+	}{
+		{models.CancellationPolicy{}, "Free cancellation"},
+		{models.CancellationPolicy{PenaltyKind: models.PenaltyPercent, PenaltyAmount: 50}, "Cancelling 50% of the total is charged"},
+		{models.CancellationPolicy{FreeDays: 1, PenaltyKind: models.PenaltyFirstNight}, "Free cancellation until 1 day before arrival, after that the first night is charged"},
+		{models.CancellationPolicy{FreeDays: 7, PenaltyKind: models.PenaltyPercent, PenaltyAmount: 100}, "Free cancellation until 7 days before arrival, after that 100% of the total is charged"},
+	}
+
+	for _, tt := range tests {
+		if got := PolicyTerms(tt.policy).String(); got != tt.want {
+			t.Errorf("PolicyTerms(%+v) = %q, want %q", tt.policy, got, tt.want)
+		}
+	}
+}
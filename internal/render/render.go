@@ -2,8 +2,13 @@ package render
 
 import (
 	"bytes"
+	"fmt"
 	"github.com/chelobotix/booking-go/internal/config"
+	"github.com/chelobotix/booking-go/internal/currency"
+	"github.com/chelobotix/booking-go/internal/dates"
+	"github.com/chelobotix/booking-go/internal/i18n"
 	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/chelobotix/booking-go/internal/pricing"
 	"github.com/justinas/nosurf"
 	"html/template"
 	"log"
@@ -14,10 +19,13 @@ import (
 
 var app *config.AppConfig
 var functions = template.FuncMap{
-	"humanDate":  HumanDate,
-	"formatDate": FormatDate,
-	"iterate":    Iterate,
-	"add":        Add,
+	"formatDate":  FormatDate,
+	"formatTime":  FormatTime,
+	"iterate":     Iterate,
+	"add":         Add,
+	"money":       Money,
+	"priceIn":     PriceIn,
+	"policyTerms": pricing.PolicyTerms,
 }
 
 // NewRenderer set the config fot the template package
@@ -25,11 +33,51 @@ func NewRenderer(appConfig *config.AppConfig) {
 	app = appConfig
 }
 
-func HumanDate(t time.Time) string {
-	return t.Format("2006-01-02")
+// Translator returns the T template function for locale, which translates a message and
+// formats it with any arguments
+func Translator(translations *i18n.Bundle, locale string) func(string, ...interface{}) string {
+	return func(message string, args ...interface{}) string {
+		return translations.Translate(locale, message, args...)
+	}
+}
+
+// MessageTranslator returns the message template function for locale, which translates a message
+// built with its arguments, such as a policy's terms
+func MessageTranslator(translations *i18n.Bundle, locale string) func(i18n.Message) string {
+	return func(m i18n.Message) string {
+		return translations.Message(locale, m)
+	}
+}
+
+// DateFormatter returns the humanDate template function for locale
+func DateFormatter(translations *i18n.Bundle, locale string) func(dates.Date) string {
+	return func(d dates.Date) string {
+		return translations.Date(locale, d.Time())
+	}
+}
+
+// PriceIn shows an amount in cents of the base currency in c, such as a reservation's own currency
+func PriceIn(c models.Currency, cents int) string {
+	return currency.Price(cents, c)
+}
+
+// DisplayCurrency is the currency the guest chose to see prices in, the base currency until they pick one
+func DisplayCurrency(r *http.Request) models.Currency {
+	if c, ok := app.Currencies.Get(app.Session.GetString(r.Context(), "currency")); ok {
+		return c
+	}
+	return app.Currencies.Base()
 }
 
-func FormatDate(t time.Time, f string) string {
+func FormatDate(d dates.Date, f string) string {
+	return d.Format(f)
+}
+
+// FormatTime formats a moment, such as when a record was made, as the clock read at the property
+func FormatTime(t time.Time, f string) string {
+	if app != nil && app.TimeZone != nil {
+		t = t.In(app.TimeZone)
+	}
 	return t.Format(f)
 }
 
@@ -48,36 +96,79 @@ func Add(a, b int) int {
 	return a + b
 }
 
-var templateCache map[string]*template.Template
+// Money formats an amount in cents
+func Money(cents int) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
 
 func AddDefaultData(td *models.TemplateData, r *http.Request) *models.TemplateData {
-	td.Flash = app.Session.PopString(r.Context(), "flash")
-	td.Warning = app.Session.PopString(r.Context(), "warning")
-	td.Error = app.Session.PopString(r.Context(), "error")
 	td.CSRFToken = nosurf.Token(r)
+
+	// messages are put in the session and form in English and translated as they are shown
+	locale := i18n.LocaleFrom(r.Context())
+	td.Locale = locale
+	td.Locales = app.Translations.Locales()
+	td.Path = r.URL.Path
+	td.Currency = DisplayCurrency(r)
+	td.Currencies = app.Currencies.Active()
+	td.Flash = popMessage(r, "flash", locale)
+	td.Warning = popMessage(r, "warning", locale)
+	td.Error = popMessage(r, "error", locale)
+	if td.Form != nil {
+		for _, messages := range td.Form.Errors {
+			for i, message := range messages {
+				messages[i] = i18n.M(app.Translations.Message(locale, message))
+			}
+		}
+	}
+
 	if app.Session.Exists(r.Context(), "user_id") {
 		td.IsAuthenticated = 1
 	}
+	if app.Session.Exists(r.Context(), "guest_id") {
+		td.IsGuest = 1
+	}
 	return td
 }
 
+// popMessage removes the message put in the session under key and returns it in locale. Messages
+// are put either as their English text or, when they have arguments, as an i18n.Message
+func popMessage(r *http.Request, key, locale string) string {
+	switch message := app.Session.Pop(r.Context(), key).(type) {
+	case string:
+		return app.Translations.Translate(locale, message)
+	case i18n.Message:
+		return app.Translations.Message(locale, message)
+	default:
+		return ""
+	}
+}
+
 func Template(w http.ResponseWriter, r *http.Request, tmpl string, td *models.TemplateData) {
-	if app.UseCache {
-		// Create a template cache
-		templateCache = app.TemplateCache
-	} else {
-		templateCache, _ = CreateTemplateCache()
+	templateCache := app.TemplateCache
+	if !app.UseCache {
+		templateCache, _ = CreateTemplateCache(app.Translations)
 	}
 
-	// get requested template from cache
-	t, ok := templateCache[tmpl]
+	td = AddDefaultData(td, r)
+
+	// get requested template from the set speaking the request's language
+	pages, ok := templateCache[td.Locale]
+	if !ok {
+		pages = templateCache[i18n.Default]
+	}
+	t, ok := pages[tmpl]
 
 	if !ok {
 		log.Fatal("could not get template from template cache", tmpl)
 	}
 
 	buffer := new(bytes.Buffer)
-	td = AddDefaultData(td, r)
 
 	_ = t.Execute(buffer, td)
 
@@ -89,8 +180,10 @@ func Template(w http.ResponseWriter, r *http.Request, tmpl string, td *models.Te
 	}
 }
 
-func CreateTemplateCache() (map[string]*template.Template, error) {
-	myCache := map[string]*template.Template{}
+// CreateTemplateCache parses the pages once for every language in translations, with T and
+// humanDate speaking it, keyed by language and then page name
+func CreateTemplateCache(translations *i18n.Bundle) (map[string]map[string]*template.Template, error) {
+	myCache := map[string]map[string]*template.Template{}
 
 	pages, err := filepath.Glob("./templates/*.page.gohtml")
 
@@ -98,29 +191,39 @@ func CreateTemplateCache() (map[string]*template.Template, error) {
 		return myCache, err
 	}
 
-	for _, page := range pages {
-		name := filepath.Base(page)
-		ts, err := template.New(name).Funcs(functions).ParseFiles(page)
+	layouts, err := filepath.Glob("./templates/*.layout.gohtml")
 
-		if err != nil {
-			return myCache, err
-		}
+	if err != nil {
+		return myCache, err
+	}
 
-		layouts, err := filepath.Glob("./templates/*.layout.gohtml")
+	for _, locale := range translations.Locales() {
+		myCache[locale] = map[string]*template.Template{}
 
-		if err != nil {
-			return myCache, err
+		localized := template.FuncMap{
+			"T":         Translator(translations, locale),
+			"message":   MessageTranslator(translations, locale),
+			"humanDate": DateFormatter(translations, locale),
 		}
 
-		if len(layouts) > 0 {
-			ts, err = ts.ParseGlob("./templates/*.layout.gohtml")
+		for _, page := range pages {
+			name := filepath.Base(page)
+			ts, err := template.New(name).Funcs(functions).Funcs(localized).ParseFiles(page)
 
 			if err != nil {
 				return myCache, err
 			}
-		}
 
-		myCache[name] = ts
+			if len(layouts) > 0 {
+				ts, err = ts.ParseGlob("./templates/*.layout.gohtml")
+
+				if err != nil {
+					return myCache, err
+				}
+			}
+
+			myCache[locale][name] = ts
+		}
 	}
 
 	return myCache, err
@@ -0,0 +1,216 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/chelobotix/booking-go/internal/models"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Audit actions
+const (
+	auditInsert  = "insert"
+	auditUpdate  = "update"
+	auditDelete  = "delete"
+	auditRestore = "restore"
+	auditPurge   = "purge"
+)
+
+// execer is satisfied by both *sql.DB and *sql.Tx so audit entries can join a transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// auditIgnored lists fields that change on every write and would only add noise to a diff, and
+// fields too sensitive to copy into the log
+var auditIgnored = map[string]bool{
+	"UpdatedAt": true,
+	"Password":  true,
+	"HoldID":    true,
+	"Payments":  true,
+	// invoice contents are copies of their reservation and payments, audited there
+	"Content": true,
+	// identity document numbers taken at check-in are kept out of the log
+	"IDNumber": true,
+}
+
+// auditChanges returns the fields that differ between before and after as
+// {"Field": {"before": x, "after": y}}, either side may be nil for inserts and deletes
+func auditChanges(before, after interface{}) (string, error) {
+	b, err := toFieldMap(before)
+	if err != nil {
+		return "", err
+	}
+
+	a, err := toFieldMap(after)
+	if err != nil {
+		return "", err
+	}
+
+	changes := make(map[string]map[string]interface{})
+
+	for field := range b {
+		if _, ok := a[field]; !ok && !auditIgnored[field] {
+			changes[field] = map[string]interface{}{"before": b[field], "after": nil}
+		}
+	}
+
+	for field, value := range a {
+		if auditIgnored[field] || reflect.DeepEqual(b[field], value) {
+			continue
+		}
+		changes[field] = map[string]interface{}{"before": b[field], "after": value}
+	}
+
+	out, err := json.Marshal(changes)
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+func toFieldMap(v interface{}) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	if v == nil {
+		return fields, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+// audit records a write made by the repository's actor
+func (m *postgresDBRepo) audit(ctx context.Context, db execer, action, entity string, entityId int, before, after interface{}) error {
+	changes, err := auditChanges(before, after)
+	if err != nil {
+		return err
+	}
+
+	var userId interface{}
+	if m.Actor.UserID > 0 {
+		userId = m.Actor.UserID
+	}
+
+	query := `INSERT INTO audit_logs (actor_type, user_id, guest_token, action, entity, entity_id, changes, ip, created_at, updated_at)
+			  values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+
+	_, err = db.ExecContext(ctx, query,
+		m.Actor.Type(),
+		userId,
+		m.Actor.GuestToken,
+		action,
+		entity,
+		entityId,
+		changes,
+		m.Actor.IP,
+		time.Now(),
+		time.Now(),
+	)
+
+	return err
+}
+
+// GetAuditLogs returns the audit trail matching the filter, newest first
+func (m *postgresDBRepo) GetAuditLogs(filter models.AuditFilter) ([]models.AuditLog, error) {
+	var logs []models.AuditLog
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var conditions []string
+	var args []interface{}
+
+	if filter.Entity != "" {
+		args = append(args, filter.Entity)
+		conditions = append(conditions, fmt.Sprintf("a.entity = $%d", len(args)))
+	}
+
+	if filter.EntityID > 0 {
+		args = append(args, filter.EntityID)
+		conditions = append(conditions, fmt.Sprintf("a.entity_id = $%d", len(args)))
+	}
+
+	if filter.Action != "" {
+		args = append(args, filter.Action)
+		conditions = append(conditions, fmt.Sprintf("a.action = $%d", len(args)))
+	}
+
+	if filter.UserID > 0 {
+		args = append(args, filter.UserID)
+		conditions = append(conditions, fmt.Sprintf("a.user_id = $%d", len(args)))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " and ")
+	}
+
+	limit := filter.PerPage
+	if limit <= 0 {
+		limit = models.DefaultPerPage
+	}
+
+	offset := 0
+	if filter.Page > 1 {
+		offset = (filter.Page - 1) * limit
+	}
+
+	query := fmt.Sprintf(`SELECT a.id, a.actor_type, COALESCE(a.user_id, 0), a.guest_token, a.action, a.entity,
+					 a.entity_id, a.changes, a.ip, a.created_at,
+					 COALESCE(u.first_name, ''), COALESCE(u.last_name, ''), COALESCE(u.email, '')
+			  FROM audit_logs a
+			  LEFT JOIN users u ON u.id = a.user_id
+			  %s
+			  ORDER BY a.created_at DESC, a.id DESC
+			  LIMIT %d OFFSET %d`, where, limit, offset)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l models.AuditLog
+
+		err := rows.Scan(
+			&l.ID,
+			&l.ActorType,
+			&l.UserID,
+			&l.GuestToken,
+			&l.Action,
+			&l.Entity,
+			&l.EntityID,
+			&l.Changes,
+			&l.IP,
+			&l.CreatedAt,
+			&l.User.FirstName,
+			&l.User.LastName,
+			&l.User.Email,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		logs = append(logs, l)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return logs, nil
+}
@@ -0,0 +1,128 @@
+package dbrepo
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/chelobotix/booking-go/internal/repository"
+	"math/big"
+	"time"
+)
+
+// confirmationAlphabet leaves out characters that are easy to misread
+const confirmationAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// newConfirmation returns a random confirmation number
+func newConfirmation() (string, error) {
+	code := make([]byte, 8)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(confirmationAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		code[i] = confirmationAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// InsertBooking books every reservation under one confirmation number. Either all rooms
+// are available and everything is inserted, or ErrNotAvailable is returned and nothing is.
+// Holds the guest placed on the rooms are converted into the reservation restrictions
+func (m *postgresDBRepo) InsertBooking(reservations []models.Reservation) (models.Booking, error) {
+	var booking models.Booking
+
+	if len(reservations) == 0 {
+		return booking, fmt.Errorf("booking has no rooms")
+	}
+
+	// rooms in the same booking may not overlap each other
+	for i, a := range reservations {
+		for _, b := range reservations[:i] {
+			if a.RoomID == b.RoomID && a.StartDate.Before(b.EndDate) && a.EndDate.After(b.StartDate) {
+				return booking, repository.ErrNotAvailable
+			}
+		}
+	}
+
+	confirmation, err := newConfirmation()
+	if err != nil {
+		return booking, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return booking, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `INSERT INTO bookings (confirmation, created_at, updated_at) values ($1, $2, $3) returning id`,
+		confirmation,
+		time.Now(),
+		time.Now(),
+	).Scan(&booking.ID)
+	if err != nil {
+		return booking, err
+	}
+	booking.Confirmation = confirmation
+
+	if err := m.audit(ctx, tx, auditInsert, "booking", booking.ID, nil, booking); err != nil {
+		return booking, err
+	}
+
+	for _, r := range reservations {
+		r.BookingID = booking.ID
+
+		newId, err := m.insertReservation(ctx, tx, r)
+		if err != nil {
+			return booking, err
+		}
+
+		if err := m.placeRestriction(ctx, tx, r, newId); err != nil {
+			return booking, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return booking, err
+	}
+
+	return booking, nil
+}
+
+// GetBookingReservations returns the reservations that belong to a booking
+func (m *postgresDBRepo) GetBookingReservations(bookingId int) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + reservationColumns + `
+			  FROM reservations r
+			  ` + reservationJoins + `
+			  WHERE r.booking_id = $1 and r.deleted_at IS NULL
+			  ORDER BY r.start_date, r.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, bookingId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var reservation models.Reservation
+		if err := scanReservation(rows, &reservation); err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, reservation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reservations, nil
+}
@@ -0,0 +1,175 @@
+package dbrepo
+
+import (
+	"context"
+	"github.com/chelobotix/booking-go/internal/models"
+	"time"
+)
+
+// currencyColumns are the columns read by scanCurrency
+const currencyColumns = `c.id, c.code, c.symbol, c.rate, c.decimals, c.round_to, c.active, c.created_at, c.updated_at`
+
+// scanCurrency reads a row selected with currencyColumns
+func scanCurrency(row scanner, c *models.Currency) error {
+	return row.Scan(
+		&c.ID,
+		&c.Code,
+		&c.Symbol,
+		&c.Rate,
+		&c.Decimals,
+		&c.RoundTo,
+		&c.Active,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+	)
+}
+
+// AllCurrencies returns every currency by code
+func (m *postgresDBRepo) AllCurrencies() ([]models.Currency, error) {
+	var currencies []models.Currency
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + currencyColumns + ` FROM currencies c ORDER BY c.code`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c models.Currency
+		if err := scanCurrency(rows, &c); err != nil {
+			return nil, err
+		}
+		currencies = append(currencies, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return currencies, nil
+}
+
+// GetCurrency returns a currency by id
+func (m *postgresDBRepo) GetCurrency(id int) (models.Currency, error) {
+	var c models.Currency
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + currencyColumns + ` FROM currencies c WHERE c.id = $1`
+
+	err := scanCurrency(m.DB.QueryRowContext(ctx, query, id), &c)
+
+	return c, err
+}
+
+// InsertCurrency adds a currency prices can be shown in
+func (m *postgresDBRepo) InsertCurrency(c models.Currency) (int, error) {
+	var newId int
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt := `INSERT INTO currencies (code, symbol, rate, decimals, round_to, active, created_at, updated_at)
+			 values ($1, $2, $3, $4, $5, $6, $7, $8) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		c.Code,
+		c.Symbol,
+		c.Rate,
+		c.Decimals,
+		c.RoundTo,
+		c.Active,
+		time.Now(),
+		time.Now(),
+	).Scan(&newId)
+	if err != nil {
+		return 0, err
+	}
+
+	c.ID = newId
+	if err := m.audit(ctx, tx, auditInsert, "currency", newId, nil, c); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return newId, nil
+}
+
+// UpdateCurrency changes the symbol, exchange rate and rounding of a currency. Reservations
+// keep the rate they were booked at
+func (m *postgresDBRepo) UpdateCurrency(c models.Currency) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var before models.Currency
+	query := `SELECT ` + currencyColumns + ` FROM currencies c WHERE c.id = $1 FOR UPDATE`
+	if err := scanCurrency(tx.QueryRowContext(ctx, query, c.ID), &before); err != nil {
+		return err
+	}
+
+	stmt := `UPDATE currencies SET symbol = $1, rate = $2, decimals = $3, round_to = $4, updated_at = $5 WHERE id = $6`
+
+	_, err = tx.ExecContext(ctx, stmt, c.Symbol, c.Rate, c.Decimals, c.RoundTo, time.Now(), c.ID)
+	if err != nil {
+		return err
+	}
+
+	after := before
+	after.Symbol = c.Symbol
+	after.Rate = c.Rate
+	after.Decimals = c.Decimals
+	after.RoundTo = c.RoundTo
+
+	if err := m.audit(ctx, tx, auditUpdate, "currency", c.ID, before, after); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetCurrencyActive offers a currency to guests or stops offering it
+func (m *postgresDBRepo) SetCurrencyActive(id int, active bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE currencies SET active = $1, updated_at = $2 WHERE id = $3`, active, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	err = m.audit(ctx, tx, auditUpdate, "currency", id,
+		models.Currency{ID: id, Active: !active},
+		models.Currency{ID: id, Active: active})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
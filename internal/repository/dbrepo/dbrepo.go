@@ -3,12 +3,14 @@ package dbrepo
 import (
 	"database/sql"
 	"github.com/chelobotix/booking-go/internal/config"
+	"github.com/chelobotix/booking-go/internal/models"
 	"github.com/chelobotix/booking-go/internal/repository"
 )
 
 type postgresDBRepo struct {
 	AppConfig *config.AppConfig
 	DB        *sql.DB
+	Actor     models.Actor
 }
 
 func NewPostgresRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo {
@@ -17,3 +19,12 @@ func NewPostgresRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo
 		DB:        conn,
 	}
 }
+
+// WithActor returns a copy of the repository that records its writes in the audit log against actor
+func (m *postgresDBRepo) WithActor(actor models.Actor) repository.DatabaseRepo {
+	return &postgresDBRepo{
+		AppConfig: m.AppConfig,
+		DB:        m.DB,
+		Actor:     actor,
+	}
+}
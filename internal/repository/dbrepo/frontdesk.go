@@ -0,0 +1,270 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"github.com/chelobotix/booking-go/internal/dates"
+	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/chelobotix/booking-go/internal/pricing"
+	"github.com/chelobotix/booking-go/internal/repository"
+	"time"
+)
+
+// ArrivalsOn returns the reservations arriving on day, checked in or not
+func (m *postgresDBRepo) ArrivalsOn(day dates.Date) ([]models.Reservation, error) {
+	return m.listFrontDesk(`r.start_date = $1`, day)
+}
+
+// DeparturesOn returns the reservations leaving on day, checked out or not
+func (m *postgresDBRepo) DeparturesOn(day dates.Date) ([]models.Reservation, error) {
+	return m.listFrontDesk(`r.end_date = $1`, day)
+}
+
+// InHouseReservations returns the guests checked in and not yet checked out
+func (m *postgresDBRepo) InHouseReservations() ([]models.Reservation, error) {
+	return m.listFrontDesk(`r.checked_in_at IS NOT NULL and r.checked_out_at IS NULL`)
+}
+
+// StaysInRoom returns the reservations in room roomId that haven't ended by day, the guests still in
+// house included
+func (m *postgresDBRepo) StaysInRoom(roomId int, day dates.Date) ([]models.Reservation, error) {
+	return m.listFrontDesk(`r.room_id = $1 and r.checked_out_at IS NULL and (r.end_date > $2 or r.checked_in_at IS NOT NULL)`, roomId, day)
+}
+
+// listFrontDesk returns the reservations that aren't deleted matching condition, by room
+func (m *postgresDBRepo) listFrontDesk(condition string, args ...interface{}) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + reservationColumns + `
+			  FROM reservations r
+			  ` + reservationJoins + `
+			  WHERE ` + condition + ` and r.deleted_at IS NULL
+			  ORDER BY r.room_id, r.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var reservation models.Reservation
+		if err := scanReservation(rows, &reservation); err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, reservation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reservations, nil
+}
+
+// lockStay locks reservation id until tx ends, so actions on a stay from the front desk, staff or
+// the guest happen one after the other, and returns it as it is once locked. Soft deleted
+// reservations are only found when includeDeleted is true
+func (m *postgresDBRepo) lockStay(ctx context.Context, tx *sql.Tx, id int, includeDeleted bool) (models.Reservation, error) {
+	var reservation models.Reservation
+
+	_, err := tx.ExecContext(ctx, `SELECT id FROM reservations WHERE id = $1 FOR UPDATE`, id)
+	if err != nil {
+		return reservation, err
+	}
+
+	query := `SELECT ` + reservationColumns + `
+			  FROM reservations r
+			  ` + reservationJoins + `
+			  WHERE r.id = $1`
+
+	if !includeDeleted {
+		query += ` and r.deleted_at IS NULL`
+	}
+
+	err = scanReservation(tx.QueryRowContext(ctx, query, id), &reservation)
+
+	return reservation, err
+}
+
+// changedStay returns the error of a front desk update, or repository.ErrStayChanged when it
+// found the stay no longer in the state it expected
+func changedStay(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return repository.ErrStayChanged
+	}
+
+	return nil
+}
+
+// CheckInReservation records the guest's identity document, when they arrived and any notes, and
+// that the front desk checked them in now. Returns repository.ErrStayChanged when they already were
+func (m *postgresDBRepo) CheckInReservation(res models.Reservation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := m.lockStay(ctx, tx, res.ID, false)
+	if err != nil {
+		return err
+	}
+	if !before.CheckedInAt.IsZero() {
+		return repository.ErrStayChanged
+	}
+
+	now := time.Now()
+
+	result, err := tx.ExecContext(ctx, `UPDATE reservations
+			  SET id_type = $1, id_number = $2, arrived_at = $3, front_desk_notes = $4, checked_in_at = $5, updated_at = $5
+			  WHERE id = $6 and checked_in_at IS NULL`,
+		res.IDType,
+		res.IDNumber,
+		res.ArrivedAt,
+		res.FrontDeskNotes,
+		now,
+		res.ID,
+	)
+	if err := changedStay(result, err); err != nil {
+		return err
+	}
+
+	after := before
+	after.IDType = res.IDType
+	after.IDNumber = res.IDNumber
+	after.ArrivedAt = res.ArrivedAt
+	after.FrontDeskNotes = res.FrontDeskNotes
+	after.CheckedInAt = now
+
+	if err := m.audit(ctx, tx, auditUpdate, "reservation", res.ID, before, after); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CheckOutReservation records that the guest left now, with the payment settling their balance when
+// it has an amount, and marks their room dirty for housekeeping. Returns repository.ErrStayChanged
+// when the guest is not in house any more, so nothing is recorded twice
+func (m *postgresDBRepo) CheckOutReservation(id int, settlement models.Payment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := m.lockStay(ctx, tx, id, false)
+	if err != nil {
+		return err
+	}
+	if !before.InHouse() {
+		return repository.ErrStayChanged
+	}
+
+	if settlement.Amount > 0 {
+		settlement.ReservationID = id
+		if _, err := m.insertPayment(ctx, tx, settlement); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+
+	result, err := tx.ExecContext(ctx, `UPDATE reservations SET checked_out_at = $1, updated_at = $1
+			  WHERE id = $2 and checked_in_at IS NOT NULL and checked_out_at IS NULL`, now, id)
+	if err := changedStay(result, err); err != nil {
+		return err
+	}
+
+	after := before
+	after.CheckedOutAt = now
+	after.Paid += settlement.Amount
+
+	if err := m.audit(ctx, tx, auditUpdate, "reservation", id, before, after); err != nil {
+		return err
+	}
+
+	if err := m.setRoomStatus(ctx, tx, before.RoomID, models.RoomDirty, ""); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ExtendReservation moves the departure of stay id to endDate, charging the added nights at the
+// room's rate, and returns the extended stay. Returns ErrNotAvailable when the room isn't free for
+// the extra nights and ErrStayChanged when the stay already ends later or has checked out
+func (m *postgresDBRepo) ExtendReservation(id int, endDate dates.Date) (models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Reservation{}, err
+	}
+	defer tx.Rollback()
+
+	before, err := m.lockStay(ctx, tx, id, false)
+	if err != nil {
+		return models.Reservation{}, err
+	}
+	if !before.CheckedOutAt.IsZero() || !endDate.After(before.EndDate) {
+		return models.Reservation{}, repository.ErrStayChanged
+	}
+
+	var room models.Room
+	err = tx.QueryRowContext(ctx, `SELECT id, price FROM rooms WHERE id = $1`, before.RoomID).Scan(&room.ID, &room.Price)
+	if err != nil {
+		return models.Reservation{}, err
+	}
+
+	after := before
+	pricing.Extend(&after, room, endDate)
+
+	if err := m.moveStay(ctx, tx, after); err != nil {
+		return models.Reservation{}, err
+	}
+
+	after.ExtendedAt = time.Now()
+
+	_, err = tx.ExecContext(ctx, `UPDATE reservations
+			  SET end_date = $1, subtotal = $2, total = $3, extended_at = $4, updated_at = $4
+			  WHERE id = $5`,
+		after.EndDate,
+		after.Subtotal,
+		after.Total,
+		after.ExtendedAt,
+		id,
+	)
+	if err != nil {
+		return models.Reservation{}, err
+	}
+
+	if err := m.audit(ctx, tx, auditUpdate, "reservation", id, before, after); err != nil {
+		return models.Reservation{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Reservation{}, err
+	}
+
+	return after, nil
+}
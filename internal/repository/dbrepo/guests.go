@@ -0,0 +1,474 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/chelobotix/booking-go/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"time"
+)
+
+// guestColumns are the columns read by scanGuest
+const guestColumns = `g.id, g.first_name, g.last_name, g.email, g.phone, g.notes, g.preferences, g.password <> '', g.email_verified_at, g.verify_expires_at, g.created_at, g.updated_at,
+				 (SELECT count(*) FROM reservations r WHERE r.guest_id = g.id and r.deleted_at IS NULL),
+				 (SELECT max(r.start_date) FROM reservations r WHERE r.guest_id = g.id and r.deleted_at IS NULL)`
+
+// scanGuest reads a row selected with guestColumns
+func scanGuest(row scanner, g *models.Guest) error {
+	var verifiedAt, verifyExpiresAt sql.NullTime
+
+	err := row.Scan(
+		&g.ID,
+		&g.FirstName,
+		&g.LastName,
+		&g.Email,
+		&g.Phone,
+		&g.Notes,
+		&g.Preferences,
+		&g.HasAccount,
+		&verifiedAt,
+		&verifyExpiresAt,
+		&g.CreatedAt,
+		&g.UpdatedAt,
+		&g.Stays,
+		&g.LastStay,
+	)
+	g.EmailVerifiedAt = verifiedAt.Time
+	g.VerifyExpiresAt = verifyExpiresAt.Time
+
+	return err
+}
+
+// normalizeEmail is how guest emails are stored and matched
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// linkGuest returns the id of the guest with the reservation's email inside tx, adding them the
+// first time and otherwise filling in the contact details their profile is missing. Details already
+// on a profile are never overwritten, anyone can book with any email. Returns 0 when the
+// reservation has no email
+func (m *postgresDBRepo) linkGuest(ctx context.Context, tx *sql.Tx, r models.Reservation) (int, error) {
+	email := normalizeEmail(r.Email)
+	if email == "" {
+		return 0, nil
+	}
+
+	guest := models.Guest{
+		FirstName: r.FirstName,
+		LastName:  r.LastName,
+		Email:     email,
+		Phone:     r.Phone,
+	}
+
+	err := tx.QueryRowContext(ctx, `INSERT INTO guests (first_name, last_name, email, phone, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $5)
+		ON CONFLICT (email) DO NOTHING
+		returning id`,
+		guest.FirstName,
+		guest.LastName,
+		guest.Email,
+		guest.Phone,
+		time.Now(),
+	).Scan(&guest.ID)
+	if err == nil {
+		return guest.ID, m.audit(ctx, tx, auditInsert, "guest", guest.ID, nil, guest)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	var before models.Guest
+	err = tx.QueryRowContext(ctx, `SELECT id, first_name, last_name, email, phone FROM guests WHERE email = $1 FOR UPDATE`, email).Scan(
+		&before.ID,
+		&before.FirstName,
+		&before.LastName,
+		&before.Email,
+		&before.Phone,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	guest = before
+	if guest.FirstName == "" {
+		guest.FirstName = r.FirstName
+	}
+	if guest.LastName == "" {
+		guest.LastName = r.LastName
+	}
+	if guest.Phone == "" {
+		guest.Phone = r.Phone
+	}
+
+	if guest == before {
+		return guest.ID, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE guests SET first_name = $1, last_name = $2, phone = $3, updated_at = $4 WHERE id = $5`,
+		guest.FirstName,
+		guest.LastName,
+		guest.Phone,
+		time.Now(),
+		guest.ID,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return guest.ID, m.audit(ctx, tx, auditUpdate, "guest", guest.ID, before, guest)
+}
+
+// AllGuests returns the guests whose name, email or phone contain search, by name
+func (m *postgresDBRepo) AllGuests(search string) ([]models.Guest, error) {
+	var guests []models.Guest
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + guestColumns + `
+			  FROM guests g
+			  WHERE $1 = '' or g.first_name ILIKE '%' || $1 || '%' or g.last_name ILIKE '%' || $1 || '%'
+			     or g.email ILIKE '%' || $1 || '%' or g.phone ILIKE '%' || $1 || '%'
+			  ORDER BY g.last_name, g.first_name, g.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, strings.TrimSpace(search))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var g models.Guest
+		if err := scanGuest(rows, &g); err != nil {
+			return nil, err
+		}
+		guests = append(guests, g)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return guests, nil
+}
+
+// GetGuest returns a guest by id
+func (m *postgresDBRepo) GetGuest(id int) (models.Guest, error) {
+	var g models.Guest
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := scanGuest(m.DB.QueryRowContext(ctx, `SELECT `+guestColumns+` FROM guests g WHERE g.id = $1`, id), &g)
+
+	return g, err
+}
+
+// GetGuestByEmail returns the guest with an email address, in any case
+func (m *postgresDBRepo) GetGuestByEmail(email string) (models.Guest, error) {
+	var g models.Guest
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := scanGuest(m.DB.QueryRowContext(ctx, `SELECT `+guestColumns+` FROM guests g WHERE g.email = $1`, normalizeEmail(email)), &g)
+
+	return g, err
+}
+
+// UpdateGuest saves a guest's name, phone, notes and preferences. The email can't change
+// as it is what reservations are matched on
+func (m *postgresDBRepo) UpdateGuest(g models.Guest) error {
+	before, err := m.GetGuest(g.ID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE guests
+		SET first_name = $1, last_name = $2, phone = $3, notes = $4, preferences = $5, updated_at = $6
+		WHERE id = $7`,
+		g.FirstName,
+		g.LastName,
+		g.Phone,
+		g.Notes,
+		g.Preferences,
+		time.Now(),
+		g.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	after := before
+	after.FirstName = g.FirstName
+	after.LastName = g.LastName
+	after.Phone = g.Phone
+	after.Notes = g.Notes
+	after.Preferences = g.Preferences
+
+	if err := m.audit(ctx, tx, auditUpdate, "guest", g.ID, before, after); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetGuestReservations returns a guest's reservations, deleted ones included, latest stay first
+func (m *postgresDBRepo) GetGuestReservations(guestId int) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + reservationColumns + `
+			  FROM reservations r
+			  ` + reservationJoins + `
+			  WHERE r.guest_id = $1
+			  ORDER BY r.start_date desc, r.id desc`
+
+	rows, err := m.DB.QueryContext(ctx, query, guestId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var res models.Reservation
+		if err := scanReservation(rows, &res); err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, res)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reservations, nil
+}
+
+// guestVerificationTime is how long the link confirming a guest's email works
+const guestVerificationTime = 48 * time.Hour
+
+// RegisterGuest starts opening an account for a guest and returns the token of the link that
+// confirms they own the email. The password only takes effect, and a guest who booked before
+// without an account only gets their past stays, once the link is followed. Returns
+// repository.ErrGuestRegistered when the email already has a confirmed account
+func (m *postgresDBRepo) RegisterGuest(g models.Guest, password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	g.Email = normalizeEmail(g.Email)
+
+	var before models.Guest
+	err = scanGuest(tx.QueryRowContext(ctx, `SELECT `+guestColumns+` FROM guests g WHERE g.email = $1 FOR UPDATE`, g.Email), &before)
+
+	expiresAt := time.Now().Add(guestVerificationTime)
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		g.VerifyExpiresAt = expiresAt
+
+		err = tx.QueryRowContext(ctx, `INSERT INTO guests (first_name, last_name, email, phone, pending_password, verify_token, verify_expires_at, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $8) returning id`,
+			g.FirstName,
+			g.LastName,
+			g.Email,
+			g.Phone,
+			string(hashedPassword),
+			token,
+			expiresAt,
+			time.Now(),
+		).Scan(&g.ID)
+		if err != nil {
+			return "", err
+		}
+
+		err = m.audit(ctx, tx, auditInsert, "guest", g.ID, nil, g)
+	case err != nil:
+		return "", err
+	case before.HasAccount && !before.EmailVerifiedAt.IsZero():
+		return "", repository.ErrGuestRegistered
+	default:
+		// the profile is left as it is until whoever registered shows they own the email
+		_, err = tx.ExecContext(ctx, `UPDATE guests SET pending_password = $1, verify_token = $2, verify_expires_at = $3, updated_at = $4 WHERE id = $5`,
+			string(hashedPassword),
+			token,
+			expiresAt,
+			time.Now(),
+			before.ID,
+		)
+		if err != nil {
+			return "", err
+		}
+
+		after := before
+		after.VerifyExpiresAt = expiresAt
+
+		err = m.audit(ctx, tx, auditUpdate, "guest", before.ID, before, after)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return token, tx.Commit()
+}
+
+// RenewGuestVerification gives an unconfirmed guest a new link to confirm their email and returns
+// the guest with its token
+func (m *postgresDBRepo) RenewGuestVerification(id int) (models.Guest, string, error) {
+	var guest models.Guest
+
+	token, err := newToken()
+	if err != nil {
+		return guest, "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return guest, "", err
+	}
+	defer tx.Rollback()
+
+	err = scanGuest(tx.QueryRowContext(ctx, `SELECT `+guestColumns+` FROM guests g WHERE g.id = $1 FOR UPDATE`, id), &guest)
+	if err != nil {
+		return guest, "", err
+	}
+	if !guest.EmailVerifiedAt.IsZero() {
+		return guest, "", errors.New("guest email is already verified")
+	}
+
+	before := guest
+	guest.VerifyExpiresAt = time.Now().Add(guestVerificationTime)
+
+	_, err = tx.ExecContext(ctx, `UPDATE guests SET verify_token = $1, verify_expires_at = $2, updated_at = $3 WHERE id = $4`,
+		token,
+		guest.VerifyExpiresAt,
+		time.Now(),
+		id,
+	)
+	if err != nil {
+		return guest, "", err
+	}
+
+	if err := m.audit(ctx, tx, auditUpdate, "guest", id, before, guest); err != nil {
+		return guest, "", err
+	}
+
+	return guest, token, tx.Commit()
+}
+
+// VerifyGuestEmail confirms the email of the guest the unexpired token was sent to, setting the
+// password they registered with, and returns their id. Returns sql.ErrNoRows for an unknown or
+// expired token
+func (m *postgresDBRepo) VerifyGuestEmail(token string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRowContext(ctx, `SELECT id FROM guests WHERE verify_token = $1 and verify_expires_at > now() FOR UPDATE`, token).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	var before models.Guest
+	err = scanGuest(tx.QueryRowContext(ctx, `SELECT `+guestColumns+` FROM guests g WHERE g.id = $1`, id), &before)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+
+	_, err = tx.ExecContext(ctx, `UPDATE guests
+			SET password = CASE WHEN pending_password <> '' THEN pending_password ELSE password END,
+			    pending_password = '', verify_token = NULL, verify_expires_at = NULL, email_verified_at = $1, updated_at = $1
+			WHERE id = $2`, now, id)
+	if err != nil {
+		return 0, err
+	}
+
+	after := before
+	after.HasAccount = true
+	after.EmailVerifiedAt = now
+	after.VerifyExpiresAt = time.Time{}
+
+	if err := m.audit(ctx, tx, auditUpdate, "guest", id, before, after); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// AuthenticateGuest returns the id of the guest with email and password. The id comes with
+// repository.ErrGuestUnverified when the guest has not confirmed their email yet
+func (m *postgresDBRepo) AuthenticateGuest(email, password string) (int, error) {
+	var id int
+	var hashedPassword string
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var verified bool
+
+	err := m.DB.QueryRowContext(ctx, `SELECT id, password, email_verified_at IS NOT NULL FROM guests WHERE email = $1`, normalizeEmail(email)).Scan(&id, &hashedPassword, &verified)
+	if err != nil {
+		return 0, err
+	}
+
+	// guests who only ever booked have no password and can't log in until they register
+	if hashedPassword == "" {
+		return 0, errors.New("guest has no account")
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return 0, errors.New("incorrect password")
+	} else if err != nil {
+		return 0, err
+	}
+
+	// accounts opened before emails were confirmed have to confirm theirs before logging in
+	if !verified {
+		return id, repository.ErrGuestUnverified
+	}
+
+	return id, nil
+}
@@ -0,0 +1,359 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"github.com/chelobotix/booking-go/internal/dates"
+	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/chelobotix/booking-go/internal/repository"
+	"time"
+)
+
+// turnoverGap is how many days restriction rr keeps its room rm empty before and after it: the room's
+// cleaning buffer, or a day when guests can't arrive on the day others leave. Cleaning restrictions,
+// whose id (models.RestrictionCleaning) the query takes as the cleaning parameter, are the buffer already
+func turnoverGap(cleaning string) string {
+	return `(CASE WHEN rr.restriction_id = ` + cleaning + ` THEN 0
+			    ELSE greatest(rm.buffer_days, CASE WHEN rm.same_day_turnover THEN 0 ELSE 1 END) END)`
+}
+
+// overlaps is the condition for a stay from start to end to clash with restriction rr on room rm,
+// which must be joined in the query. cleaning is the parameter holding models.RestrictionCleaning
+func overlaps(start, end, cleaning string) string {
+	gap := turnoverGap(cleaning)
+	return start + ` < rr.end_date + ` + gap + ` and ` + end + ` + ` + gap + ` > rr.start_date`
+}
+
+// overlapQuery counts the restrictions on room $3 that overlap $1-$2, holds count only until they
+// expire. $4 is models.RestrictionCleaning
+var overlapQuery = `SELECT count(rr.id)
+			  FROM room_restrictions rr
+			  JOIN rooms rm ON rm.id = rr.room_id
+			  WHERE ` + overlaps("$1::date", "$2::date", "$4::int") + ` and rr.room_id = $3
+			    and (rr.expires_at IS NULL or rr.expires_at > now())`
+
+// bookableQuery counts what stops guests booking room $3 for $1-$2: the restrictions overlapping
+// the stay, or the room being out of order ($5). $4 is models.RestrictionCleaning
+var bookableQuery = `SELECT (` + overlapQuery + `) + (SELECT count(id) FROM rooms WHERE id = $3 and status = $5)`
+
+// InsertHold holds a room for the dates until expiresAt, returns ErrNotAvailable when it is taken
+func (m *postgresDBRepo) InsertHold(roomId int, startDate, endDate dates.Date, expiresAt time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	newId, err := insertHold(ctx, tx, roomId, startDate, endDate, expiresAt)
+	if err != nil {
+		return 0, err
+	}
+
+	err = m.audit(ctx, tx, auditInsert, "room_restriction", newId, nil, models.RoomRestriction{
+		ID:            newId,
+		StartDate:     startDate,
+		EndDate:       endDate,
+		RoomID:        roomId,
+		RestrictionID: models.RestrictionHold,
+		ExpiresAt:     expiresAt,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return newId, nil
+}
+
+// lockRoom locks room roomId until tx ends, serialising whatever checks the room is free and then
+// takes it so two writers can't both see it free
+func lockRoom(ctx context.Context, tx *sql.Tx, roomId int) error {
+	_, err := tx.ExecContext(ctx, `SELECT id FROM rooms WHERE id = $1 FOR UPDATE`, roomId)
+	return err
+}
+
+// insertHold places a hold inside tx, see InsertHold
+func insertHold(ctx context.Context, tx *sql.Tx, roomId int, startDate, endDate dates.Date, expiresAt time.Time) (int, error) {
+	var newId int
+
+	err := lockRoom(ctx, tx, roomId)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	err = tx.QueryRowContext(ctx, bookableQuery, startDate, endDate, roomId, models.RestrictionCleaning, models.RoomOutOfOrder).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	if count > 0 {
+		return 0, repository.ErrNotAvailable
+	}
+
+	query := `INSERT INTO room_restrictions (start_date, end_date, room_id, restriction_id, expires_at, created_at, updated_at)
+			 values ($1, $2, $3, $4, $5, $6, $7) returning id`
+
+	err = tx.QueryRowContext(ctx, query,
+		startDate,
+		endDate,
+		roomId,
+		models.RestrictionHold,
+		expiresAt,
+		time.Now(),
+		time.Now(),
+	).Scan(&newId)
+	if err != nil {
+		return 0, err
+	}
+
+	return newId, nil
+}
+
+// ReleaseHold removes a hold before it expires, e.g. when the guest picks another room. A hold
+// behind a waitlist offer is kept so the offer link keeps working until the offer runs out
+func (m *postgresDBRepo) ReleaseHold(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	holds, err := deleteHolds(ctx, tx, `id = $2
+			  and NOT EXISTS (SELECT 1 FROM waitlist_entries w WHERE w.hold_id = $2 and w.status = $3)`,
+		id, models.WaitlistOffered)
+	if err != nil {
+		return err
+	}
+
+	if err := m.auditDeleted(ctx, tx, holds); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteExpiredHolds removes holds whose time ran out and returns how many there were
+func (m *postgresDBRepo) DeleteExpiredHolds() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	holds, err := deleteHolds(ctx, tx, `expires_at <= now()`)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := m.auditDeleted(ctx, tx, holds); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(holds), nil
+}
+
+// deleteHolds deletes the holds matching condition inside tx and returns them, $1 is the hold
+// restriction and further arguments start at $2
+func deleteHolds(ctx context.Context, tx *sql.Tx, condition string, args ...interface{}) ([]models.RoomRestriction, error) {
+	return deleteRestrictions(ctx, tx, `restriction_id = $1 and `+condition, append([]interface{}{models.RestrictionHold}, args...)...)
+}
+
+// deleteRestrictions deletes the room restrictions matching condition inside tx and returns them
+func deleteRestrictions(ctx context.Context, tx *sql.Tx, condition string, args ...interface{}) ([]models.RoomRestriction, error) {
+	query := `DELETE FROM room_restrictions
+			  WHERE ` + condition + `
+			  RETURNING id, start_date, end_date, room_id, COALESCE(reservation_id, 0), restriction_id, expires_at`
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var restrictions []models.RoomRestriction
+
+	for rows.Next() {
+		var restriction models.RoomRestriction
+		var expiresAt sql.NullTime
+
+		err := rows.Scan(
+			&restriction.ID,
+			&restriction.StartDate,
+			&restriction.EndDate,
+			&restriction.RoomID,
+			&restriction.ReservationID,
+			&restriction.RestrictionID,
+			&expiresAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		restriction.ExpiresAt = expiresAt.Time
+
+		restrictions = append(restrictions, restriction)
+	}
+
+	return restrictions, rows.Err()
+}
+
+// auditDeleted records the deletion of room restrictions
+func (m *postgresDBRepo) auditDeleted(ctx context.Context, tx *sql.Tx, restrictions []models.RoomRestriction) error {
+	for _, restriction := range restrictions {
+		if err := m.audit(ctx, tx, auditDelete, "room_restriction", restriction.ID, restriction, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConfirmReservation inserts the reservation and turns the guest's hold into its room restriction,
+// when the hold has expired the room is checked again and ErrNotAvailable returned if it was taken
+func (m *postgresDBRepo) ConfirmReservation(r models.Reservation) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	newId, err := m.insertReservation(ctx, tx, r)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := m.placeRestriction(ctx, tx, r, newId); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return newId, nil
+}
+
+// placeRestriction books the room for reservationId inside tx. A live hold matching the
+// reservation is converted in place, otherwise the room is checked and a new restriction inserted
+func (m *postgresDBRepo) placeRestriction(ctx context.Context, tx *sql.Tx, r models.Reservation, reservationId int) error {
+	if r.HoldID > 0 {
+		result, err := tx.ExecContext(ctx, `UPDATE room_restrictions
+			SET reservation_id = $1, restriction_id = $2, expires_at = NULL, updated_at = $3
+			WHERE id = $4 and restriction_id = $5 and expires_at > now()
+			  and room_id = $6 and start_date = $7 and end_date = $8`,
+			reservationId,
+			models.RestrictionReservation,
+			time.Now(),
+			r.HoldID,
+			models.RestrictionHold,
+			r.RoomID,
+			r.StartDate,
+			r.EndDate,
+		)
+		if err != nil {
+			return err
+		}
+
+		converted, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if converted == 1 {
+			err = m.audit(ctx, tx, auditUpdate, "room_restriction", r.HoldID,
+				models.RoomRestriction{ID: r.HoldID, RoomID: r.RoomID, StartDate: r.StartDate, EndDate: r.EndDate, RestrictionID: models.RestrictionHold},
+				models.RoomRestriction{ID: r.HoldID, RoomID: r.RoomID, StartDate: r.StartDate, EndDate: r.EndDate, RestrictionID: models.RestrictionReservation, ReservationID: reservationId})
+			if err != nil {
+				return err
+			}
+
+			if err := m.bookWaitlistOffer(ctx, tx, r.HoldID); err != nil {
+				return err
+			}
+
+			return m.placeCleaning(ctx, tx, r, reservationId)
+		}
+	}
+
+	err := lockRoom(ctx, tx, r.RoomID)
+	if err != nil {
+		return err
+	}
+
+	var count int
+	err = tx.QueryRowContext(ctx, bookableQuery, r.StartDate, r.EndDate, r.RoomID, models.RestrictionCleaning, models.RoomOutOfOrder).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return repository.ErrNotAvailable
+	}
+
+	err = m.insertRestriction(ctx, tx, models.RoomRestriction{
+		StartDate:     r.StartDate,
+		EndDate:       r.EndDate,
+		RoomID:        r.RoomID,
+		ReservationID: reservationId,
+		RestrictionID: models.RestrictionReservation,
+	})
+	if err != nil {
+		return err
+	}
+
+	return m.placeCleaning(ctx, tx, r, reservationId)
+}
+
+// placeCleaning blocks the room's cleaning buffer after the stay of reservationId inside tx
+func (m *postgresDBRepo) placeCleaning(ctx context.Context, tx *sql.Tx, r models.Reservation, reservationId int) error {
+	var buffer int
+	err := tx.QueryRowContext(ctx, `SELECT buffer_days FROM rooms WHERE id = $1`, r.RoomID).Scan(&buffer)
+	if err != nil {
+		return err
+	}
+	if buffer <= 0 {
+		return nil
+	}
+
+	return m.insertRestriction(ctx, tx, models.RoomRestriction{
+		StartDate:     r.EndDate,
+		EndDate:       r.EndDate.AddDays(buffer),
+		RoomID:        r.RoomID,
+		ReservationID: reservationId,
+		RestrictionID: models.RestrictionCleaning,
+	})
+}
+
+// insertRestriction adds a restriction tied to a reservation inside tx
+func (m *postgresDBRepo) insertRestriction(ctx context.Context, tx *sql.Tx, restriction models.RoomRestriction) error {
+	err := tx.QueryRowContext(ctx, `INSERT INTO room_restrictions (start_date, end_date, room_id, reservation_id, restriction_id, created_at, updated_at)
+			 values ($1, $2, $3 , $4, $5, $6, $7) returning id`,
+		restriction.StartDate,
+		restriction.EndDate,
+		restriction.RoomID,
+		restriction.ReservationID,
+		restriction.RestrictionID,
+		time.Now(),
+		time.Now(),
+	).Scan(&restriction.ID)
+	if err != nil {
+		return err
+	}
+
+	return m.audit(ctx, tx, auditInsert, "room_restriction", restriction.ID, nil, restriction)
+}
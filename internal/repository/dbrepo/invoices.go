@@ -0,0 +1,136 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/chelobotix/booking-go/internal/pricing"
+	"time"
+)
+
+// IssueInvoice returns the invoice for a reservation, issuing it with the next number the first time.
+// What it bills is copied from the reservation and its payments when it is issued, along with the
+// property name and tax it is issued under, and never changes after
+func (m *postgresDBRepo) IssueInvoice(reservationId int, property string, taxPercent int) (models.Invoice, error) {
+	var inv models.Invoice
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return inv, err
+	}
+	defer tx.Rollback()
+
+	// the stay can't change while it is copied
+	res, err := m.lockStay(ctx, tx, reservationId, false)
+	if err != nil {
+		return inv, err
+	}
+
+	// numbers must not repeat or skip, so issuing is done one at a time
+	_, err = tx.ExecContext(ctx, `LOCK TABLE invoices IN SHARE ROW EXCLUSIVE MODE`)
+	if err != nil {
+		return inv, err
+	}
+
+	var content []byte
+	err = tx.QueryRowContext(ctx, `SELECT id, reservation_id, number, issued_at, content, created_at, updated_at
+		FROM invoices WHERE reservation_id = $1`, reservationId).Scan(
+		&inv.ID,
+		&inv.ReservationID,
+		&inv.Number,
+		&inv.IssuedAt,
+		&content,
+		&inv.CreatedAt,
+		&inv.UpdatedAt,
+	)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return inv, err
+	}
+	if err == nil && content != nil {
+		return inv, json.Unmarshal(content, &inv.Content)
+	}
+
+	inv.Content, err = invoiceContent(ctx, tx, res, property, taxPercent)
+	if err != nil {
+		return inv, err
+	}
+
+	content, err = json.Marshal(inv.Content)
+	if err != nil {
+		return inv, err
+	}
+
+	now := time.Now()
+
+	if inv.ID > 0 {
+		// issued before invoices kept their content, it is copied the first time it is asked for again
+		_, err = tx.ExecContext(ctx, `UPDATE invoices SET content = $1, updated_at = $2 WHERE id = $3`, content, now, inv.ID)
+		if err != nil {
+			return inv, err
+		}
+		inv.UpdatedAt = now
+
+		return inv, tx.Commit()
+	}
+
+	inv = models.Invoice{
+		ReservationID: reservationId,
+		IssuedAt:      now,
+		Content:       inv.Content,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	err = tx.QueryRowContext(ctx, `INSERT INTO invoices (reservation_id, number, issued_at, content, created_at, updated_at)
+		SELECT $1, COALESCE(max(number), 0) + 1, $2, $3, $2, $2 FROM invoices
+		returning id, number`, reservationId, now, content).Scan(&inv.ID, &inv.Number)
+	if err != nil {
+		return inv, err
+	}
+
+	if err := m.audit(ctx, tx, auditInsert, "invoice", inv.ID, nil, inv); err != nil {
+		return inv, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return inv, err
+	}
+
+	return inv, nil
+}
+
+// invoiceContent copies what an invoice for res bills inside tx: a line per night at its share of
+// the subtotal, the reservation's totals and the payments made so far
+func invoiceContent(ctx context.Context, tx *sql.Tx, res models.Reservation, property string, taxPercent int) (models.InvoiceContent, error) {
+	payments, err := paymentsFor(ctx, tx, res.ID)
+	if err != nil {
+		return models.InvoiceContent{}, err
+	}
+
+	// nothing from the front desk is printed on an invoice, so none of it is kept with one
+	res.IDType = ""
+	res.IDNumber = ""
+	res.FrontDeskNotes = ""
+
+	var lines []models.InvoiceLine
+	for i, rate := range pricing.NightlyRates(res) {
+		lines = append(lines, models.InvoiceLine{
+			Date:        res.StartDate.AddDays(i),
+			Description: res.Room.RoomName,
+			Amount:      rate,
+		})
+	}
+
+	return models.InvoiceContent{
+		Property:    property,
+		TaxPercent:  taxPercent,
+		Reservation: res,
+		Lines:       lines,
+		Payments:    payments,
+	}, nil
+}
@@ -0,0 +1,119 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"github.com/chelobotix/booking-go/internal/models"
+	"time"
+)
+
+// paidColumn is the amount paid on reservation r, charges less refunds
+const paidColumn = `COALESCE((SELECT sum(CASE WHEN p.kind = 'refund' THEN -p.amount ELSE p.amount END)
+				           FROM payments p WHERE p.reservation_id = r.id), 0)`
+
+// InsertPayment records a payment on a reservation
+func (m *postgresDBRepo) InsertPayment(p models.Payment) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	newId, err := m.insertPayment(ctx, tx, p)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return newId, nil
+}
+
+// insertPayment inserts and audits a payment inside tx
+func (m *postgresDBRepo) insertPayment(ctx context.Context, tx *sql.Tx, p models.Payment) (int, error) {
+	var newId int
+
+	var refundOf interface{}
+	if p.RefundOf > 0 {
+		refundOf = p.RefundOf
+	}
+
+	stmt := `INSERT INTO payments (reservation_id, kind, amount, description, reference, refund_of, created_at, updated_at)
+			 values ($1, $2, $3, $4, $5, $6, $7, $8) returning id`
+
+	err := tx.QueryRowContext(ctx, stmt,
+		p.ReservationID,
+		p.Kind,
+		p.Amount,
+		p.Description,
+		p.Reference,
+		refundOf,
+		time.Now(),
+		time.Now(),
+	).Scan(&newId)
+	if err != nil {
+		return 0, err
+	}
+
+	p.ID = newId
+	if err := m.audit(ctx, tx, auditInsert, "payment", newId, nil, p); err != nil {
+		return 0, err
+	}
+
+	return newId, nil
+}
+
+// GetPaymentsForReservation returns the payments on a reservation, oldest first
+func (m *postgresDBRepo) GetPaymentsForReservation(reservationId int) ([]models.Payment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return paymentsFor(ctx, m.DB, reservationId)
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// paymentsFor returns the payments of a reservation, oldest first
+func paymentsFor(ctx context.Context, db queryer, reservationId int) ([]models.Payment, error) {
+	var payments []models.Payment
+
+	query := `SELECT id, reservation_id, kind, amount, description, reference, COALESCE(refund_of, 0), created_at, updated_at
+			  FROM payments
+			  WHERE reservation_id = $1
+			  ORDER BY created_at, id`
+
+	rows, err := db.QueryContext(ctx, query, reservationId)
+	if err != nil {
+		return payments, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.Payment
+		err := rows.Scan(
+			&p.ID,
+			&p.ReservationID,
+			&p.Kind,
+			&p.Amount,
+			&p.Description,
+			&p.Reference,
+			&p.RefundOf,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+		)
+		if err != nil {
+			return payments, err
+		}
+		payments = append(payments, p)
+	}
+
+	return payments, rows.Err()
+}
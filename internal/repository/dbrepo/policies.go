@@ -0,0 +1,159 @@
+package dbrepo
+
+import (
+	"context"
+	"github.com/chelobotix/booking-go/internal/models"
+	"time"
+)
+
+// policyColumns are the columns read by scanCancellationPolicy
+const policyColumns = `cp.id, cp.name, cp.description, COALESCE(cp.room_id, 0), cp.free_days, cp.penalty_kind,
+				 cp.penalty_amount, cp.active, cp.created_at, cp.updated_at, COALESCE(rm.room_name, '')`
+
+// scanCancellationPolicy reads a row selected with policyColumns
+func scanCancellationPolicy(row scanner, policy *models.CancellationPolicy) error {
+	err := row.Scan(
+		&policy.ID,
+		&policy.Name,
+		&policy.Description,
+		&policy.RoomID,
+		&policy.FreeDays,
+		&policy.PenaltyKind,
+		&policy.PenaltyAmount,
+		&policy.Active,
+		&policy.CreatedAt,
+		&policy.UpdatedAt,
+		&policy.Room.RoomName,
+	)
+	policy.Room.ID = policy.RoomID
+
+	return err
+}
+
+// GetCancellationPolicies returns every cancellation policy, newest first
+func (m *postgresDBRepo) GetCancellationPolicies() ([]models.CancellationPolicy, error) {
+	var policies []models.CancellationPolicy
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + policyColumns + `
+			  FROM cancellation_policies cp
+			  LEFT JOIN rooms rm ON rm.id = cp.room_id
+			  ORDER BY cp.created_at desc, cp.id desc`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var policy models.CancellationPolicy
+		if err := scanCancellationPolicy(rows, &policy); err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return policies, nil
+}
+
+// GetCancellationPolicyForRoom returns the active policy for a room, its own newest one before the
+// newest one for all rooms. Returns sql.ErrNoRows when no policy applies
+func (m *postgresDBRepo) GetCancellationPolicyForRoom(roomId int) (models.CancellationPolicy, error) {
+	var policy models.CancellationPolicy
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + policyColumns + `
+			  FROM cancellation_policies cp
+			  LEFT JOIN rooms rm ON rm.id = cp.room_id
+			  WHERE cp.active and (cp.room_id = $1 or cp.room_id IS NULL)
+			  ORDER BY cp.room_id IS NULL, cp.created_at desc, cp.id desc
+			  LIMIT 1`
+
+	err := scanCancellationPolicy(m.DB.QueryRowContext(ctx, query, roomId), &policy)
+
+	return policy, err
+}
+
+// InsertCancellationPolicy adds a cancellation policy. Policies are never edited so that
+// reservations keep the terms they were booked under
+func (m *postgresDBRepo) InsertCancellationPolicy(policy models.CancellationPolicy) (int, error) {
+	var newId int
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var roomId interface{}
+	if policy.RoomID > 0 {
+		roomId = policy.RoomID
+	}
+
+	stmt := `INSERT INTO cancellation_policies (name, description, room_id, free_days, penalty_kind, penalty_amount, active, created_at, updated_at)
+			 values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		policy.Name,
+		policy.Description,
+		roomId,
+		policy.FreeDays,
+		policy.PenaltyKind,
+		policy.PenaltyAmount,
+		policy.Active,
+		time.Now(),
+		time.Now(),
+	).Scan(&newId)
+	if err != nil {
+		return 0, err
+	}
+
+	policy.ID = newId
+	if err := m.audit(ctx, tx, auditInsert, "cancellation_policy", newId, nil, policy); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return newId, nil
+}
+
+// SetCancellationPolicyActive switches a policy on or off for new bookings
+func (m *postgresDBRepo) SetCancellationPolicyActive(id int, active bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE cancellation_policies SET active = $1, updated_at = $2 WHERE id = $3`, active, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	err = m.audit(ctx, tx, auditUpdate, "cancellation_policy", id,
+		models.CancellationPolicy{ID: id, Active: !active},
+		models.CancellationPolicy{ID: id, Active: active})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
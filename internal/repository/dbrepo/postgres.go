@@ -2,9 +2,14 @@ package dbrepo
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"github.com/chelobotix/booking-go/internal/dates"
 	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/chelobotix/booking-go/internal/repository"
 	"golang.org/x/crypto/bcrypt"
+	"strings"
 	"time"
 )
 
@@ -13,15 +18,59 @@ func (m *postgresDBRepo) AllUsers() bool {
 }
 
 func (m *postgresDBRepo) InsertReservation(r models.Reservation) (int, error) {
-	var newId int
-
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	stmt := `INSERT INTO reservations (first_name, last_name, email, phone, start_date, end_date, room_id, created_at, updated_at)
-			 values ($1, $2, $3 , $4, $5, $6, $7, $8, $9) returning id`
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	newId, err := m.insertReservation(ctx, tx, r)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return newId, nil
+}
+
+// insertReservation inserts and audits a reservation and its payments inside tx, redeeming its promo code if it has one.
+// Returns ErrPromoUnavailable when the code was used up in the meantime
+func (m *postgresDBRepo) insertReservation(ctx context.Context, tx *sql.Tx, r models.Reservation) (int, error) {
+	var newId int
+
+	guestId, err := m.linkGuest(ctx, tx, r)
+	if err != nil {
+		return 0, err
+	}
+	r.GuestID = guestId
+
+	var bookingId, promoCodeId, policyId interface{}
+	if r.BookingID > 0 {
+		bookingId = r.BookingID
+	}
+	if r.CancellationPolicyID > 0 {
+		policyId = r.CancellationPolicyID
+	}
+	if r.PromoCodeID > 0 {
+		promoCodeId = r.PromoCodeID
+
+		if err := m.redeemPromoCode(ctx, tx, r.PromoCodeID); err != nil {
+			return 0, err
+		}
+	}
+
+	stmt := `INSERT INTO reservations (first_name, last_name, email, phone, start_date, end_date, room_id, adults, children,
+			     booking_id, subtotal, discount, total, promo_code_id, cancellation_policy_id, guest_id, currency, exchange_rate,
+			     created_at, updated_at)
+			 values ($1, $2, $3 , $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20) returning id`
 
-	err := m.DB.QueryRowContext(ctx, stmt,
+	err = tx.QueryRowContext(ctx, stmt,
 		r.FirstName,
 		r.LastName,
 		r.Email,
@@ -29,48 +78,82 @@ func (m *postgresDBRepo) InsertReservation(r models.Reservation) (int, error) {
 		r.StartDate,
 		r.EndDate,
 		r.RoomID,
+		r.Adults,
+		r.Children,
+		bookingId,
+		r.Subtotal,
+		r.Discount,
+		r.Total,
+		promoCodeId,
+		policyId,
+		nullInt(guestId),
+		r.Currency.Code,
+		r.Currency.Rate,
 		time.Now(),
 		time.Now(),
 	).Scan(&newId)
-
 	if err != nil {
 		return 0, err
 	}
+
+	r.ID = newId
+	if err := m.audit(ctx, tx, auditInsert, "reservation", newId, nil, r); err != nil {
+		return 0, err
+	}
+
+	for _, p := range r.Payments {
+		p.ReservationID = newId
+		if _, err := m.insertPayment(ctx, tx, p); err != nil {
+			return 0, err
+		}
+	}
+
 	return newId, nil
 }
 
 func (m *postgresDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
+	var newId int
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `INSERT INTO room_restrictions (start_date, end_date, room_id, reservation_id, restriction_id, created_at, updated_at)
-			 values ($1, $2, $3 , $4, $5, $6, $7 )`
+			 values ($1, $2, $3 , $4, $5, $6, $7 ) returning id`
 
-	_, err := m.DB.ExecContext(ctx, query,
+	err = tx.QueryRowContext(ctx, query,
 		r.StartDate,
 		r.EndDate,
 		r.RoomID,
 		r.ReservationID,
 		r.RestrictionID,
 		time.Now(),
-		time.Now())
+		time.Now(),
+	).Scan(&newId)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	r.ID = newId
+	err = m.audit(ctx, tx, auditInsert, "room_restriction", newId, nil, r)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (m *postgresDBRepo) SearchAvailabilityByDateByRoomId(startDate, endDate time.Time, roomId int) (bool, error) {
+func (m *postgresDBRepo) SearchAvailabilityByDateByRoomId(startDate, endDate dates.Date, roomId int) (bool, error) {
 	var result int
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `SELECT count(id)
-			  FROM room_restrictions
-			  WHERE $1 < end_date and $2 > start_date and room_id = $3`
-
-	row := m.DB.QueryRowContext(ctx, query, startDate, endDate, roomId)
+	row := m.DB.QueryRowContext(ctx, bookableQuery, startDate, endDate, roomId, models.RestrictionCleaning, models.RoomOutOfOrder)
 	err := row.Scan(&result)
 	if err != nil {
 		return false, err
@@ -83,27 +166,36 @@ func (m *postgresDBRepo) SearchAvailabilityByDateByRoomId(startDate, endDate tim
 	return false, nil
 }
 
-func (m *postgresDBRepo) SearchAvailabilityForAllRooms(startDate, endDate time.Time) ([]models.Room, error) {
+// SearchAvailabilityForAllRooms returns the rooms free for the dates that sleep at least guests people,
+// a guests value of 0 skips the capacity check. Out of order rooms are never free
+func (m *postgresDBRepo) SearchAvailabilityForAllRooms(startDate, endDate dates.Date, guests int) ([]models.Room, error) {
 	var availableRooms []models.Room
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `SELECT r.id, r.room_name
+	query := `SELECT r.id, r.room_name, r.max_occupancy, r.price
 			  FROM rooms r
-			  WHERE r.id not in(SELECT room_id
+			  WHERE r.id not in(SELECT rr.room_id
 			                  FROM room_restrictions rr
-			            	  WHERE $1 < rr.end_date and $2 > start_date)`
+			                  JOIN rooms rm ON rm.id = rr.room_id
+			            	  WHERE ` + overlaps("$1::date", "$2::date", "$5::int") + `
+			            	    and (rr.expires_at IS NULL or rr.expires_at > now()))
+			    and r.max_occupancy >= $3 and r.status <> $4
+			  ORDER BY r.max_occupancy, r.id`
 
-	rows, err := m.DB.QueryContext(ctx, query, startDate, endDate)
+	rows, err := m.DB.QueryContext(ctx, query, startDate, endDate, guests, models.RoomOutOfOrder, models.RestrictionCleaning)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var room models.Room
 		err := rows.Scan(
 			&room.ID,
 			&room.RoomName,
+			&room.MaxOccupancy,
+			&room.Price,
 		)
 		if err != nil {
 			return nil, err
@@ -119,18 +211,68 @@ func (m *postgresDBRepo) SearchAvailabilityForAllRooms(startDate, endDate time.T
 	return availableRooms, nil
 }
 
+// SearchAvailableWindows finds stays of nights nights arriving between from and to in rooms that sleep
+// guests people and aren't out of order, by room and nearest to the preferred arrival first
+func (m *postgresDBRepo) SearchAvailableWindows(from, to, preferred dates.Date, nights, guests int) ([]models.AvailableWindow, error) {
+	var windows []models.AvailableWindow
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT id, room_name, max_occupancy, price, start_date, end_date
+			  FROM (SELECT r.id, r.room_name, r.max_occupancy, r.price, d.start_date, d.start_date + $3::int AS end_date,
+			               row_number() OVER (PARTITION BY r.id ORDER BY abs(d.start_date - $5::date), d.start_date) AS n
+			        FROM rooms r
+			        CROSS JOIN (SELECT generate_series($1::date, $2::date, interval '1 day')::date AS start_date) d
+			        WHERE r.max_occupancy >= $4 and r.status <> $6
+			          and not exists(SELECT 1
+			                         FROM room_restrictions rr
+			                         JOIN rooms rm ON rm.id = rr.room_id
+			                         WHERE rr.room_id = r.id and ` + overlaps("d.start_date", "(d.start_date + $3::int)", "$7::int") + `
+			                           and (rr.expires_at IS NULL or rr.expires_at > now()))) w
+			  ORDER BY id, n`
+
+	rows, err := m.DB.QueryContext(ctx, query, from, to, nights, guests, preferred, models.RoomOutOfOrder, models.RestrictionCleaning)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var window models.AvailableWindow
+		err := rows.Scan(
+			&window.Room.ID,
+			&window.Room.RoomName,
+			&window.Room.MaxOccupancy,
+			&window.Room.Price,
+			&window.StartDate,
+			&window.EndDate,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		windows = append(windows, window)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return windows, nil
+}
+
 func (m *postgresDBRepo) GetRoomById(id int) (models.Room, error) {
 	var room models.Room
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `SELECT *
+	query := `SELECT ` + roomColumns + `
 			  FROM rooms
 			  WHERE rooms.id = $1`
 
 	row := m.DB.QueryRowContext(ctx, query, id)
 
-	err := row.Scan(&room.ID, &room.RoomName, &room.CreatedAt, &room.UpdatedAt)
+	err := scanRoom(row, &room)
 
 	if err != nil {
 		return room, err
@@ -146,8 +288,9 @@ func (m *postgresDBRepo) GetAllRooms() ([]models.Room, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `SELECT *
-			  FROM rooms`
+	query := `SELECT ` + roomColumns + `
+			  FROM rooms
+			  ORDER BY id`
 
 	rows, err := m.DB.QueryContext(ctx, query)
 	if err != nil {
@@ -157,7 +300,7 @@ func (m *postgresDBRepo) GetAllRooms() ([]models.Room, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		err := rows.Scan(&room.ID, &room.RoomName, &room.CreatedAt, &room.UpdatedAt)
+		err := scanRoom(rows, &room)
 		if err != nil {
 			return rooms, err
 		}
@@ -189,12 +332,24 @@ func (m *postgresDBRepo) GetUserById(id int) (models.User, error) {
 }
 
 func (m *postgresDBRepo) UpdateUser(u models.User) error {
+	before, err := m.GetUserById(u.ID)
+	if err != nil {
+		return err
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `UPDATE users SET first_name = $1, last_name = $2, email = $3, access_level = $4, updated_at = $5`
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	_, err := m.DB.ExecContext(
+	query := `UPDATE users SET first_name = $1, last_name = $2, email = $3, access_level = $4, updated_at = $5
+			  WHERE id = $6`
+
+	_, err = tx.ExecContext(
 		ctx,
 		query,
 		u.FirstName,
@@ -202,13 +357,21 @@ func (m *postgresDBRepo) UpdateUser(u models.User) error {
 		u.Email,
 		u.AccessLevel,
 		time.Now(),
+		u.ID,
 	)
 
 	if err != nil {
 		return err
 	}
 
-	return nil
+	u.Password = before.Password
+	u.CreatedAt = before.CreatedAt
+	err = m.audit(ctx, tx, auditUpdate, "user", u.ID, before, u)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string, error) {
@@ -239,121 +402,98 @@ func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string,
 	return id, hashedPassword, nil
 }
 
-func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
+func (m *postgresDBRepo) AllReservations(filter models.ReservationFilter) ([]models.Reservation, int, error) {
+	return m.listReservations(filter)
+}
+
+func (m *postgresDBRepo) AllNewReservations(filter models.ReservationFilter) ([]models.Reservation, int, error) {
+	filter.Status = models.StatusNew
+	return m.listReservations(filter)
+}
+
+// listReservations returns one page of reservations matching the filter and the total number of matches
+func (m *postgresDBRepo) listReservations(filter models.ReservationFilter) ([]models.Reservation, int, error) {
 	var reservation models.Reservation
 	var reservations []models.Reservation
+	var total int
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `SELECT r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date,
-       				 r.room_id, r.created_at, r.updated_at, r.processed, rm.id, rm.room_name
+	where, args := reservationFilterClause(filter)
+
+	countQuery := `SELECT count(r.id)
 			  FROM reservations r
-			  LEFT JOIN rooms rm ON rm.id = r.room_id
-			  ORDER BY r.start_date`
+			  ` + reservationJoins + `
+			  ` + where
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	err := m.DB.QueryRowContext(ctx, countQuery, args...).Scan(&total)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		err := rows.Scan(
-			&reservation.ID,
-			&reservation.FirstName,
-			&reservation.LastName, &reservation.Email,
-			&reservation.Phone,
-			&reservation.StartDate,
-			&reservation.EndDate,
-			&reservation.RoomID,
-			&reservation.CreatedAt,
-			&reservation.UpdatedAt,
-			&reservation.Processed,
-			&reservation.Room.ID,
-			&reservation.Room.RoomName,
-		)
-
-		if err != nil {
-			return nil, err
-		}
-		reservations = append(reservations, reservation)
+	limit := filter.PerPage
+	if limit <= 0 {
+		limit = models.DefaultPerPage
 	}
 
-	return reservations, nil
-}
-
-func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
-	var reservation models.Reservation
-	var reservations []models.Reservation
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	offset := 0
+	if filter.Page > 1 {
+		offset = (filter.Page - 1) * limit
+	}
 
-	query := `SELECT r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date,
-       				 r.room_id, r.created_at, r.updated_at, r.processed, rm.id, rm.room_name
+	query := fmt.Sprintf(`SELECT %s
 			  FROM reservations r
-			  LEFT JOIN rooms rm ON rm.id = r.room_id
-			  WHERE r.processed = 0
-			  ORDER BY r.start_date`
+			  %s
+			  %s
+			  %s
+			  LIMIT %d OFFSET %d`, reservationColumns, reservationJoins, where, reservationOrderClause(filter), limit, offset)
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		err := rows.Scan(
-			&reservation.ID,
-			&reservation.FirstName,
-			&reservation.LastName, &reservation.Email,
-			&reservation.Phone,
-			&reservation.StartDate,
-			&reservation.EndDate,
-			&reservation.RoomID,
-			&reservation.CreatedAt,
-			&reservation.UpdatedAt,
-			&reservation.Processed,
-			&reservation.Room.ID,
-			&reservation.Room.RoomName,
-		)
+		err := scanReservation(rows, &reservation)
 
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		reservations = append(reservations, reservation)
 	}
 
-	return reservations, nil
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return reservations, total, nil
 }
 
 func (m *postgresDBRepo) GetReservation(id int) (models.Reservation, error) {
+	return m.getReservation(id, false)
+}
+
+// getReservation reads a reservation by id, deleted ones are only returned when includeDeleted is set
+func (m *postgresDBRepo) getReservation(id int, includeDeleted bool) (models.Reservation, error) {
 	var reservation models.Reservation
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `SELECT r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date,
-       				 r.room_id, r.created_at, r.updated_at, r.processed, rm.id, rm.room_name
+	query := `SELECT ` + reservationColumns + `
 			  FROM reservations r
-			  LEFT JOIN rooms rm ON rm.id = r.room_id
+			  ` + reservationJoins + `
 			  WHERE r.id = $1`
 
+	if !includeDeleted {
+		query += ` and r.deleted_at IS NULL`
+	}
+
 	row := m.DB.QueryRowContext(ctx, query, id)
 
-	err := row.Scan(
-		&reservation.ID,
-		&reservation.FirstName,
-		&reservation.LastName, &reservation.Email,
-		&reservation.Phone,
-		&reservation.StartDate,
-		&reservation.EndDate,
-		&reservation.RoomID,
-		&reservation.CreatedAt,
-		&reservation.UpdatedAt,
-		&reservation.Processed,
-		&reservation.Room.ID,
-		&reservation.Room.RoomName,
-	)
+	err := scanReservation(row, &reservation)
 
 	if err != nil {
 		return reservation, err
@@ -362,21 +502,62 @@ func (m *postgresDBRepo) GetReservation(id int) (models.Reservation, error) {
 	return reservation, nil
 }
 
+// UpdateReservation saves the guest details, dates, room and price of a reservation. When the
+// dates or room change, availability is checked against every other restriction and the
+// reservation's own restriction is moved in the same transaction, as are res.Payments recorded,
+// such as a deposit taken for the new dates. Returns repository.ErrStayChanged when the
+// reservation was deleted meanwhile
 func (m *postgresDBRepo) UpdateReservation(res models.Reservation) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := m.lockStay(ctx, tx, res.ID, false)
+	if errors.Is(err, sql.ErrNoRows) {
+		return repository.ErrStayChanged
+	}
+	if err != nil {
+		return err
+	}
+
+	moved := res.StartDate != before.StartDate || res.EndDate != before.EndDate || res.RoomID != before.RoomID
+
+	if moved {
+		if err := m.moveStay(ctx, tx, res); err != nil {
+			return err
+		}
+	}
+
+	guestId, err := m.linkGuest(ctx, tx, res)
+	if err != nil {
+		return err
+	}
+
 	query := `UPDATE reservations
-			  SET first_name = $1, last_name = $2, email = $3, phone = $4, updated_at = $5
-			  WHERE id = $6`
+			  SET first_name = $1, last_name = $2, email = $3, phone = $4, start_date = $5, end_date = $6,
+			      room_id = $7, guest_id = $8, subtotal = $9, discount = $10, total = $11, promo_code_id = $12, updated_at = $13
+			  WHERE id = $14`
 
-	_, err := m.DB.ExecContext(
+	_, err = tx.ExecContext(
 		ctx,
 		query,
 		res.FirstName,
 		res.LastName,
 		res.Email,
 		res.Phone,
+		res.StartDate,
+		res.EndDate,
+		res.RoomID,
+		nullInt(guestId),
+		res.Subtotal,
+		res.Discount,
+		res.Total,
+		nullInt(res.PromoCodeID),
 		time.Now(),
 		res.ID,
 	)
@@ -385,49 +566,335 @@ func (m *postgresDBRepo) UpdateReservation(res models.Reservation) error {
 		return err
 	}
 
-	return nil
+	after := before
+	after.FirstName = res.FirstName
+	after.LastName = res.LastName
+	after.Email = res.Email
+	after.Phone = res.Phone
+	after.StartDate = res.StartDate
+	after.EndDate = res.EndDate
+	after.RoomID = res.RoomID
+	after.GuestID = guestId
+	after.Subtotal = res.Subtotal
+	after.Discount = res.Discount
+	after.Total = res.Total
+	after.PromoCodeID = res.PromoCodeID
+	after.PromoCode = res.PromoCode
+
+	err = m.audit(ctx, tx, auditUpdate, "reservation", res.ID, before, after)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range res.Payments {
+		p.ReservationID = res.ID
+		if _, err := m.insertPayment(ctx, tx, p); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
+// moveStay checks res's room can be booked for its dates apart from its own restrictions, so it
+// isn't out of order either, and moves them there inside tx, the cleaning after the stay with them
+func (m *postgresDBRepo) moveStay(ctx context.Context, tx *sql.Tx, res models.Reservation) error {
+	if err := lockRoom(ctx, tx, res.RoomID); err != nil {
+		return err
+	}
+
+	var count int
+	query := `SELECT (SELECT count(rr.id)
+			  FROM room_restrictions rr
+			  JOIN rooms rm ON rm.id = rr.room_id
+			  WHERE ` + overlaps("$1::date", "$2::date", "$6::int") + ` and rr.room_id = $3
+			    and (rr.expires_at IS NULL or rr.expires_at > now())
+			    and (rr.reservation_id IS NULL or rr.reservation_id <> $4))
+			  + (SELECT count(id) FROM rooms WHERE id = $3 and status = $5)`
+
+	err := tx.QueryRowContext(ctx, query, res.StartDate, res.EndDate, res.RoomID, res.ID, models.RoomOutOfOrder, models.RestrictionCleaning).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return repository.ErrNotAvailable
+	}
+
+	var moved []models.RoomRestriction
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, start_date, end_date, room_id FROM room_restrictions
+			  WHERE reservation_id = $1 and restriction_id = $2`, res.ID, models.RestrictionReservation)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		restriction := models.RoomRestriction{ReservationID: res.ID, RestrictionID: models.RestrictionReservation}
+		if err := rows.Scan(&restriction.ID, &restriction.StartDate, &restriction.EndDate, &restriction.RoomID); err != nil {
+			rows.Close()
+			return err
+		}
+		moved = append(moved, restriction)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, before := range moved {
+		after := before
+		after.StartDate = res.StartDate
+		after.EndDate = res.EndDate
+		after.RoomID = res.RoomID
+
+		_, err = tx.ExecContext(ctx, `UPDATE room_restrictions SET start_date = $1, end_date = $2, room_id = $3, updated_at = $4 WHERE id = $5`,
+			after.StartDate,
+			after.EndDate,
+			after.RoomID,
+			time.Now(),
+			after.ID,
+		)
+		if err != nil {
+			return err
+		}
+
+		if err := m.audit(ctx, tx, auditUpdate, "room_restriction", after.ID, before, after); err != nil {
+			return err
+		}
+	}
+
+	// the cleaning follows the stay to its new departure and room
+	cleanings, err := deleteRestrictions(ctx, tx, `reservation_id = $1 and restriction_id = $2`, res.ID, models.RestrictionCleaning)
+	if err != nil {
+		return err
+	}
+	if err := m.auditDeleted(ctx, tx, cleanings); err != nil {
+		return err
+	}
+
+	return m.placeCleaning(ctx, tx, res, res.ID)
+}
+
+// DeleteReservation soft deletes a reservation. Its room restriction is removed so the
+// dates become bookable again, RestoreReservation puts it back. Returns repository.ErrStayChanged
+// when it was already deleted, so a cancellation is only acted on once
 func (m *postgresDBRepo) DeleteReservation(id int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `DELETE FROM reservations WHERE id = $1`
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := m.lockStay(ctx, tx, id, false)
+	if errors.Is(err, sql.ErrNoRows) {
+		return repository.ErrStayChanged
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	result, err := tx.ExecContext(ctx, `UPDATE reservations SET deleted_at = $1, updated_at = $1
+			  WHERE id = $2 and deleted_at IS NULL`, now, id)
+	if err := changedStay(result, err); err != nil {
+		return err
+	}
+
+	restrictions, err := deleteRestrictions(ctx, tx, `reservation_id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if err := m.auditDeleted(ctx, tx, restrictions); err != nil {
+		return err
+	}
+
+	after := before
+	after.DeletedAt = now
+
+	err = m.audit(ctx, tx, auditDelete, "reservation", id, before, after)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RestoreReservation brings a soft deleted reservation back, provided its room is still bookable
+// for its dates. A reservation whose guest was refunded on cancellation is not restored, it
+// returns repository.ErrRefunded, as the stay would be kept without being paid for
+func (m *postgresDBRepo) RestoreReservation(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := m.lockStay(ctx, tx, id, true)
+	if err != nil {
+		return err
+	}
 
-	_, err := m.DB.ExecContext(ctx, query, id)
+	if before.DeletedAt.IsZero() {
+		return repository.ErrStayChanged
+	}
 
+	var refunds int
+	err = tx.QueryRowContext(ctx, `SELECT count(id) FROM payments WHERE reservation_id = $1 and kind = $2`,
+		id, models.PaymentRefund).Scan(&refunds)
 	if err != nil {
 		return err
 	}
+	if refunds > 0 {
+		return repository.ErrRefunded
+	}
 
-	return nil
+	if err := lockRoom(ctx, tx, before.RoomID); err != nil {
+		return err
+	}
+
+	var count int
+	err = tx.QueryRowContext(ctx, bookableQuery, before.StartDate, before.EndDate, before.RoomID, models.RestrictionCleaning, models.RoomOutOfOrder).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return repository.ErrNotAvailable
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE reservations SET deleted_at = NULL, updated_at = $1 WHERE id = $2`, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO room_restrictions (start_date, end_date, room_id, reservation_id, restriction_id, created_at, updated_at)
+			 values ($1, $2, $3 , $4, $5, $6, $7 )`,
+		before.StartDate,
+		before.EndDate,
+		before.RoomID,
+		id,
+		models.RestrictionReservation,
+		time.Now(),
+		time.Now())
+	if err != nil {
+		return err
+	}
+
+	if err := m.placeCleaning(ctx, tx, before, id); err != nil {
+		return err
+	}
+
+	after := before
+	after.DeletedAt = time.Time{}
+
+	err = m.audit(ctx, tx, auditRestore, "reservation", id, before, after)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// PurgeDeletedReservations permanently removes reservations soft deleted before the given time.
+// Reservations with payments or an invoice are kept, they are part of the financial records
+func (m *postgresDBRepo) PurgeDeletedReservations(before time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `DELETE FROM reservations r
+			  WHERE r.deleted_at < $1
+			    and NOT EXISTS (SELECT 1 FROM payments p WHERE p.reservation_id = r.id)
+			    and NOT EXISTS (SELECT 1 FROM invoices i WHERE i.reservation_id = r.id)
+			  returning r.id`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		if err := m.audit(ctx, tx, auditPurge, "reservation", id, nil, nil); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(ids), nil
 }
 
 func (m *postgresDBRepo) UpdateProcessedForReservation(id, processed int) error {
+	before, err := m.GetReservation(id)
+	if err != nil {
+		return err
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `UPDATE reservations SET processed = $1 WHERE id = $2`
 
-	_, err := m.DB.ExecContext(ctx, query, processed, id)
+	_, err = tx.ExecContext(ctx, query, processed, id)
 
 	if err != nil {
 		return err
 	}
 
-	return nil
+	after := before
+	after.Processed = processed
+
+	err = m.audit(ctx, tx, auditUpdate, "reservation", id, before, after)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomId int, startDate, endDate time.Time) ([]models.RoomRestriction, error) {
+// GetRestrictionsForRoomByDate returns the restrictions on a room overlapping the dates, including live holds
+func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomId int, startDate, endDate dates.Date) ([]models.RoomRestriction, error) {
 	var roomRestriction models.RoomRestriction
 	var roomRestrictions []models.RoomRestriction
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `SELECT r.id, r.start_date, r.end_date, COALESCE(r.room_id, 0), r.reservation_id, r.restriction_id
+	query := `SELECT r.id, r.start_date, r.end_date, COALESCE(r.room_id, 0), COALESCE(r.reservation_id, 0), r.restriction_id
 			  FROM room_restrictions r
-			  WHERE r.room_id = $1 and start_date < $2 and end_date > $3`
+			  WHERE r.room_id = $1 and start_date < $2 and end_date > $3
+			    and (r.expires_at IS NULL or r.expires_at > now())`
 
 	rows, err := m.DB.QueryContext(ctx, query, roomId, endDate, startDate)
 	if err != nil {
@@ -453,3 +920,295 @@ func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomId int, startDate, end
 
 	return roomRestrictions, nil
 }
+
+// reservationColumns is the select list read by scanReservation
+const reservationColumns = `r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date,
+       				 r.room_id, r.created_at, r.updated_at, r.processed, r.deleted_at, COALESCE(rm.id, 0), COALESCE(rm.room_name, ''),
+       				 COALESCE(rm.check_in_time, ''), COALESCE(rm.check_out_time, ''),
+       				 COALESCE(r.booking_id, 0), COALESCE(b.confirmation, ''), r.adults, r.children,
+       				 r.subtotal, r.discount, r.total, COALESCE(r.promo_code_id, 0), COALESCE(pc.code, ''),
+       				 COALESCE(cp.id, 0), COALESCE(cp.name, ''), COALESCE(cp.description, ''), COALESCE(cp.free_days, 0),
+       				 COALESCE(cp.penalty_kind, ''), COALESCE(cp.penalty_amount, 0),
+       				 COALESCE(r.guest_id, 0), r.currency, r.exchange_rate, COALESCE(cur.symbol, ''),
+       				 COALESCE(cur.decimals, 2), COALESCE(cur.round_to, 1),
+       				 r.id_type, r.id_number, r.arrived_at, r.checked_in_at, r.checked_out_at, r.extended_at, r.front_desk_notes,
+       				 ` + paidColumn
+
+// reservationJoins are the joins needed by reservationColumns
+const reservationJoins = `LEFT JOIN rooms rm ON rm.id = r.room_id
+			  LEFT JOIN bookings b ON b.id = r.booking_id
+			  LEFT JOIN promo_codes pc ON pc.id = r.promo_code_id
+			  LEFT JOIN cancellation_policies cp ON cp.id = r.cancellation_policy_id
+			  LEFT JOIN currencies cur ON cur.code = r.currency`
+
+// scanner is satisfied by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanReservation reads a row selected with reservationColumns
+func scanReservation(row scanner, reservation *models.Reservation) error {
+	var deletedAt, arrivedAt, checkedInAt, checkedOutAt, extendedAt sql.NullTime
+
+	err := row.Scan(
+		&reservation.ID,
+		&reservation.FirstName,
+		&reservation.LastName, &reservation.Email,
+		&reservation.Phone,
+		&reservation.StartDate,
+		&reservation.EndDate,
+		&reservation.RoomID,
+		&reservation.CreatedAt,
+		&reservation.UpdatedAt,
+		&reservation.Processed,
+		&deletedAt,
+		&reservation.Room.ID,
+		&reservation.Room.RoomName,
+		&reservation.Room.CheckInTime,
+		&reservation.Room.CheckOutTime,
+		&reservation.BookingID,
+		&reservation.Booking.Confirmation,
+		&reservation.Adults,
+		&reservation.Children,
+		&reservation.Subtotal,
+		&reservation.Discount,
+		&reservation.Total,
+		&reservation.PromoCodeID,
+		&reservation.PromoCode,
+		&reservation.CancellationPolicy.ID,
+		&reservation.CancellationPolicy.Name,
+		&reservation.CancellationPolicy.Description,
+		&reservation.CancellationPolicy.FreeDays,
+		&reservation.CancellationPolicy.PenaltyKind,
+		&reservation.CancellationPolicy.PenaltyAmount,
+		&reservation.GuestID,
+		&reservation.Currency.Code,
+		&reservation.Currency.Rate,
+		&reservation.Currency.Symbol,
+		&reservation.Currency.Decimals,
+		&reservation.Currency.RoundTo,
+		&reservation.IDType,
+		&reservation.IDNumber,
+		&arrivedAt,
+		&checkedInAt,
+		&checkedOutAt,
+		&extendedAt,
+		&reservation.FrontDeskNotes,
+		&reservation.Paid,
+	)
+	if err != nil {
+		return err
+	}
+
+	reservation.DeletedAt = deletedAt.Time
+	reservation.ArrivedAt = arrivedAt.Time
+	reservation.CheckedInAt = checkedInAt.Time
+	reservation.CheckedOutAt = checkedOutAt.Time
+	reservation.ExtendedAt = extendedAt.Time
+	reservation.Booking.ID = reservation.BookingID
+	reservation.CancellationPolicyID = reservation.CancellationPolicy.ID
+
+	return nil
+}
+
+// reservationFilterClause builds the WHERE clause and arguments for a reservation filter
+func reservationFilterClause(filter models.ReservationFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if !filter.StartDate.IsZero() {
+		args = append(args, filter.StartDate)
+		conditions = append(conditions, fmt.Sprintf("r.start_date >= $%d", len(args)))
+	}
+
+	if !filter.EndDate.IsZero() {
+		args = append(args, filter.EndDate)
+		conditions = append(conditions, fmt.Sprintf("r.start_date <= $%d", len(args)))
+	}
+
+	if filter.RoomID > 0 {
+		args = append(args, filter.RoomID)
+		conditions = append(conditions, fmt.Sprintf("r.room_id = $%d", len(args)))
+	}
+
+	if filter.Search != "" {
+		args = append(args, "%"+filter.Search+"%")
+		conditions = append(conditions, fmt.Sprintf("(r.first_name ILIKE $%[1]d or r.last_name ILIKE $%[1]d or r.email ILIKE $%[1]d or b.confirmation ILIKE $%[1]d)", len(args)))
+	}
+
+	switch filter.Status {
+	case models.StatusNew:
+		conditions = append(conditions, "r.processed = 0")
+	case models.StatusProcessed:
+		conditions = append(conditions, "r.processed = 1")
+	}
+
+	// deleted reservations only ever show up in the trash
+	if filter.Trashed {
+		conditions = append(conditions, "r.deleted_at IS NOT NULL")
+	} else {
+		conditions = append(conditions, "r.deleted_at IS NULL")
+	}
+
+	return "WHERE " + strings.Join(conditions, " and "), args
+}
+
+// reservationOrderClause builds the ORDER BY clause for a reservation filter,
+// only whitelisted columns are ever interpolated into the query
+func reservationOrderClause(filter models.ReservationFilter) string {
+	column := "r.start_date"
+	if filter.Sort == models.SortCreatedAt {
+		column = "r.created_at"
+	}
+
+	direction := "ASC"
+	if filter.Descending {
+		direction = "DESC"
+	}
+
+	return fmt.Sprintf("ORDER BY %s %s, r.id %s", column, direction, direction)
+}
+
+// StreamReservations calls fn for every reservation matching the filter, one row at a time
+func (m *postgresDBRepo) StreamReservations(filter models.ReservationFilter, fn func(models.Reservation) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	where, args := reservationFilterClause(filter)
+
+	query := `SELECT ` + reservationColumns + `
+			  FROM reservations r
+			  ` + reservationJoins + `
+			  ` + where + `
+			  ` + reservationOrderClause(filter)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var reservation models.Reservation
+
+		err := scanReservation(rows, &reservation)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(reservation); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// ImportReservationsAndBlocks inserts reservations with their restrictions and owner blocks
+// in a single transaction, nothing is written if any row fails or overlaps
+func (m *postgresDBRepo) ImportReservationsAndBlocks(reservations []models.Reservation, blocks []models.RoomRestriction) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	restrictionQuery := `INSERT INTO room_restrictions (start_date, end_date, room_id, reservation_id, restriction_id, created_at, updated_at)
+			 values ($1, $2, $3 , $4, $5, $6, $7 )`
+
+	checkOverlap := func(startDate, endDate dates.Date, roomId int) error {
+		var count int
+		err := tx.QueryRowContext(ctx, overlapQuery, startDate, endDate, roomId, models.RestrictionCleaning).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("room %d from %s to %s: %w", roomId, startDate.Format("2006-01-02"), endDate.Format("2006-01-02"), repository.ErrNotAvailable)
+		}
+		return nil
+	}
+
+	for _, r := range reservations {
+		if err := checkOverlap(r.StartDate, r.EndDate, r.RoomID); err != nil {
+			return err
+		}
+
+		guestId, err := m.linkGuest(ctx, tx, r)
+		if err != nil {
+			return err
+		}
+		r.GuestID = guestId
+
+		var newId int
+		stmt := `INSERT INTO reservations (first_name, last_name, email, phone, start_date, end_date, room_id, processed, guest_id, created_at, updated_at)
+			 values ($1, $2, $3 , $4, $5, $6, $7, $8, $9, $10, $11) returning id`
+
+		err = tx.QueryRowContext(ctx, stmt,
+			r.FirstName,
+			r.LastName,
+			r.Email,
+			r.Phone,
+			r.StartDate,
+			r.EndDate,
+			r.RoomID,
+			r.Processed,
+			nullInt(guestId),
+			time.Now(),
+			time.Now(),
+		).Scan(&newId)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, restrictionQuery,
+			r.StartDate,
+			r.EndDate,
+			r.RoomID,
+			newId,
+			models.RestrictionReservation,
+			time.Now(),
+			time.Now())
+		if err != nil {
+			return err
+		}
+
+		if err := m.placeCleaning(ctx, tx, r, newId); err != nil {
+			return err
+		}
+
+		r.ID = newId
+		if err := m.audit(ctx, tx, auditInsert, "reservation", newId, nil, r); err != nil {
+			return err
+		}
+	}
+
+	for _, b := range blocks {
+		if err := checkOverlap(b.StartDate, b.EndDate, b.RoomID); err != nil {
+			return err
+		}
+
+		var blockId int
+		err = tx.QueryRowContext(ctx, restrictionQuery+` returning id`,
+			b.StartDate,
+			b.EndDate,
+			b.RoomID,
+			nil,
+			models.RestrictionOwnerBlock,
+			time.Now(),
+			time.Now(),
+		).Scan(&blockId)
+		if err != nil {
+			return err
+		}
+
+		b.ID = blockId
+		if err := m.audit(ctx, tx, auditInsert, "room_restriction", blockId, nil, b); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,191 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/chelobotix/booking-go/internal/models"
+	"github.com/chelobotix/booking-go/internal/repository"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// promoColumns are the columns read by scanPromoCode
+const promoColumns = `p.id, p.code, p.description, p.kind, p.amount, p.valid_from, p.valid_to, p.min_nights,
+				 p.max_uses, p.uses, p.active, p.created_at, p.updated_at,
+				 COALESCE((SELECT string_agg(pr.room_id::text, ',' ORDER BY pr.room_id)
+				           FROM promo_code_rooms pr WHERE pr.promo_code_id = p.id), '')`
+
+// scanPromoCode reads a row selected with promoColumns
+func scanPromoCode(row scanner, promo *models.PromoCode) error {
+	var roomIds string
+
+	err := row.Scan(
+		&promo.ID,
+		&promo.Code,
+		&promo.Description,
+		&promo.Kind,
+		&promo.Amount,
+		&promo.ValidFrom,
+		&promo.ValidTo,
+		&promo.MinNights,
+		&promo.MaxUses,
+		&promo.Uses,
+		&promo.Active,
+		&promo.CreatedAt,
+		&promo.UpdatedAt,
+		&roomIds,
+	)
+	if err != nil {
+		return err
+	}
+
+	promo.RoomIDs = nil
+	for _, id := range strings.Split(roomIds, ",") {
+		if roomId, err := strconv.Atoi(id); err == nil {
+			promo.RoomIDs = append(promo.RoomIDs, roomId)
+		}
+	}
+
+	return nil
+}
+
+// GetPromoCodes returns every promo code, newest first
+func (m *postgresDBRepo) GetPromoCodes() ([]models.PromoCode, error) {
+	var promos []models.PromoCode
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT `+promoColumns+` FROM promo_codes p ORDER BY p.created_at desc, p.id desc`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var promo models.PromoCode
+		if err := scanPromoCode(rows, &promo); err != nil {
+			return nil, err
+		}
+		promos = append(promos, promo)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return promos, nil
+}
+
+// GetPromoCodeByCode looks up a promo code, codes are stored upper case
+func (m *postgresDBRepo) GetPromoCodeByCode(code string) (models.PromoCode, error) {
+	var promo models.PromoCode
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, `SELECT `+promoColumns+` FROM promo_codes p WHERE p.code = $1`, code)
+	err := scanPromoCode(row, &promo)
+
+	return promo, err
+}
+
+// InsertPromoCode adds a promo code with the rooms it is limited to
+func (m *postgresDBRepo) InsertPromoCode(promo models.PromoCode) (int, error) {
+	var newId int
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt := `INSERT INTO promo_codes (code, description, kind, amount, valid_from, valid_to, min_nights, max_uses, uses, active, created_at, updated_at)
+			 values ($1, $2, $3, $4, $5, $6, $7, $8, 0, $9, $10, $11) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		promo.Code,
+		promo.Description,
+		promo.Kind,
+		promo.Amount,
+		promo.ValidFrom,
+		promo.ValidTo,
+		promo.MinNights,
+		promo.MaxUses,
+		promo.Active,
+		time.Now(),
+		time.Now(),
+	).Scan(&newId)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, roomId := range promo.RoomIDs {
+		_, err = tx.ExecContext(ctx, `INSERT INTO promo_code_rooms (promo_code_id, room_id, created_at, updated_at) values ($1, $2, $3, $4)`,
+			newId, roomId, time.Now(), time.Now())
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	promo.ID = newId
+	if err := m.audit(ctx, tx, auditInsert, "promo_code", newId, nil, promo); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return newId, nil
+}
+
+// SetPromoCodeActive switches a promo code on or off, codes already used stay on their reservations
+func (m *postgresDBRepo) SetPromoCodeActive(id int, active bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE promo_codes SET active = $1, updated_at = $2 WHERE id = $3`, active, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	err = m.audit(ctx, tx, auditUpdate, "promo_code", id,
+		models.PromoCode{ID: id, Active: !active},
+		models.PromoCode{ID: id, Active: active})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// redeemPromoCode counts a use of the promo code inside tx, returning ErrPromoUnavailable
+// when it has been deactivated or reached its usage limit
+func (m *postgresDBRepo) redeemPromoCode(ctx context.Context, tx *sql.Tx, id int) error {
+	var uses int
+	err := tx.QueryRowContext(ctx, `UPDATE promo_codes SET uses = uses + 1, updated_at = $1
+		WHERE id = $2 and active and (max_uses = 0 or uses < max_uses)
+		returning uses`, time.Now(), id).Scan(&uses)
+	if errors.Is(err, sql.ErrNoRows) {
+		return repository.ErrPromoUnavailable
+	}
+	if err != nil {
+		return err
+	}
+
+	return m.audit(ctx, tx, auditUpdate, "promo_code", id,
+		models.PromoCode{ID: id, Active: true, Uses: uses - 1},
+		models.PromoCode{ID: id, Active: true, Uses: uses})
+}
@@ -0,0 +1,198 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"github.com/chelobotix/booking-go/internal/dates"
+	"github.com/chelobotix/booking-go/internal/models"
+	"time"
+)
+
+// roomColumns is the select list read by scanRoom
+const roomColumns = `id, room_name, max_occupancy, price, check_in_time, check_out_time, buffer_days,
+				 same_day_turnover, status, status_note, status_updated_at, created_at, updated_at`
+
+// roomFields are where the columns of roomColumns are scanned to
+func roomFields(room *models.Room, statusUpdatedAt *sql.NullTime) []interface{} {
+	return []interface{}{
+		&room.ID,
+		&room.RoomName,
+		&room.MaxOccupancy,
+		&room.Price,
+		&room.CheckInTime,
+		&room.CheckOutTime,
+		&room.BufferDays,
+		&room.SameDayTurnover,
+		&room.Status,
+		&room.StatusNote,
+		statusUpdatedAt,
+		&room.CreatedAt,
+		&room.UpdatedAt,
+	}
+}
+
+// scanRoom reads a row selected with roomColumns
+func scanRoom(row scanner, room *models.Room) error {
+	var statusUpdatedAt sql.NullTime
+
+	if err := row.Scan(roomFields(room, &statusUpdatedAt)...); err != nil {
+		return err
+	}
+
+	room.StatusUpdatedAt = statusUpdatedAt.Time
+
+	return nil
+}
+
+// UpdateRoomTurnover changes a room's check-in and check-out times and how it is turned over between
+// stays. Cleaning already blocked for booked stays is left as it is
+func (m *postgresDBRepo) UpdateRoomTurnover(room models.Room) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var before models.Room
+	query := `SELECT ` + roomColumns + ` FROM rooms WHERE id = $1 FOR UPDATE`
+	if err := scanRoom(tx.QueryRowContext(ctx, query, room.ID), &before); err != nil {
+		return err
+	}
+
+	stmt := `UPDATE rooms
+			 SET check_in_time = $1, check_out_time = $2, buffer_days = $3, same_day_turnover = $4, updated_at = $5
+			 WHERE id = $6`
+
+	_, err = tx.ExecContext(ctx, stmt,
+		room.CheckInTime,
+		room.CheckOutTime,
+		room.BufferDays,
+		room.SameDayTurnover,
+		time.Now(),
+		room.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	after := before
+	after.CheckInTime = room.CheckInTime
+	after.CheckOutTime = room.CheckOutTime
+	after.BufferDays = room.BufferDays
+	after.SameDayTurnover = room.SameDayTurnover
+
+	if err := m.audit(ctx, tx, auditUpdate, "room", room.ID, before, after); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateRoomStatus records where housekeeping is with a room
+func (m *postgresDBRepo) UpdateRoomStatus(id int, status, note string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.setRoomStatus(ctx, tx, id, status, note); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// setRoomStatus changes a room's status inside tx, see UpdateRoomStatus
+func (m *postgresDBRepo) setRoomStatus(ctx context.Context, tx *sql.Tx, id int, status, note string) error {
+	var before models.Room
+	query := `SELECT ` + roomColumns + ` FROM rooms WHERE id = $1 FOR UPDATE`
+	if err := scanRoom(tx.QueryRowContext(ctx, query, id), &before); err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	_, err := tx.ExecContext(ctx, `UPDATE rooms SET status = $1, status_note = $2, status_updated_at = $3, updated_at = $3 WHERE id = $4`,
+		status, note, now, id)
+	if err != nil {
+		return err
+	}
+
+	after := before
+	after.Status = status
+	after.StatusNote = note
+	after.StatusUpdatedAt = now
+
+	return m.audit(ctx, tx, auditUpdate, "room", id, before, after)
+}
+
+// HousekeepingTasks returns every room with what it needs on day: the guests leaving and arriving
+// that day, and whether it is blocked for cleaning
+func (m *postgresDBRepo) HousekeepingTasks(day dates.Date) ([]models.HousekeepingTask, error) {
+	var tasks []models.HousekeepingTask
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + roomColumns + `,
+				 COALESCE(dr.id, 0), COALESCE(dr.first_name, ''), COALESCE(dr.last_name, ''), dr.checked_out_at,
+				 COALESCE(ar.id, 0), COALESCE(ar.first_name, ''), COALESCE(ar.last_name, ''),
+				 COALESCE(ar.adults, 0), COALESCE(ar.children, 0),
+				 exists(SELECT 1 FROM room_restrictions c
+				        WHERE c.room_id = rooms.id and c.restriction_id = $3 and c.start_date <= $1 and c.end_date > $1)
+			  FROM rooms
+			  LEFT JOIN room_restrictions d ON d.room_id = rooms.id and d.restriction_id = $2 and d.end_date = $1
+			  LEFT JOIN reservations dr ON dr.id = d.reservation_id
+			  LEFT JOIN room_restrictions a ON a.room_id = rooms.id and a.restriction_id = $2 and a.start_date = $1
+			  LEFT JOIN reservations ar ON ar.id = a.reservation_id
+			  ORDER BY rooms.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, day, models.RestrictionReservation, models.RestrictionCleaning)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		task := models.HousekeepingTask{Day: day}
+
+		var statusUpdatedAt, checkedOutAt sql.NullTime
+		err := rows.Scan(append(roomFields(&task.Room, &statusUpdatedAt),
+			&task.Departure.ID,
+			&task.Departure.FirstName,
+			&task.Departure.LastName,
+			&checkedOutAt,
+			&task.Arrival.ID,
+			&task.Arrival.FirstName,
+			&task.Arrival.LastName,
+			&task.Arrival.Adults,
+			&task.Arrival.Children,
+			&task.Cleaning,
+		)...)
+		if err != nil {
+			return nil, err
+		}
+		task.Room.StatusUpdatedAt = statusUpdatedAt.Time
+		task.Departure.CheckedOutAt = checkedOutAt.Time
+
+		task.Departed = task.Departure.CheckedOutAt
+		if task.Departed.IsZero() {
+			task.Departed = day.In(m.AppConfig.TimeZone)
+		}
+
+		tasks = append(tasks, task)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tasks, nil
+}
@@ -0,0 +1,170 @@
+package dbrepo
+
+import (
+	"context"
+	"github.com/chelobotix/booking-go/internal/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formatWeekdays stores weekdays as a comma separated list, e.g. "0,6" for Sunday and Saturday
+func formatWeekdays(days []time.Weekday) string {
+	var parts []string
+	for _, day := range days {
+		parts = append(parts, strconv.Itoa(int(day)))
+	}
+	return strings.Join(parts, ",")
+}
+
+// parseWeekdays reads a list written by formatWeekdays
+func parseWeekdays(s string) []time.Weekday {
+	var days []time.Weekday
+	for _, part := range strings.Split(s, ",") {
+		if day, err := strconv.Atoi(part); err == nil && day >= 0 && day <= 6 {
+			days = append(days, time.Weekday(day))
+		}
+	}
+	return days
+}
+
+// nullInt stores an id of 0 as NULL
+func nullInt(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// GetBookingRules returns every booking rule
+func (m *postgresDBRepo) GetBookingRules() ([]models.BookingRule, error) {
+	var rules []models.BookingRule
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT b.id, b.name, COALESCE(b.room_id, 0), b.season_start, b.season_end, b.min_nights, b.max_nights,
+			         b.min_notice_hours, b.max_horizon_days, b.no_arrival_days, b.no_departure_days,
+			         b.created_at, b.updated_at, COALESCE(rm.room_name, '')
+			  FROM booking_rules b
+			  LEFT JOIN rooms rm ON rm.id = b.room_id
+			  ORDER BY b.room_id NULLS FIRST, b.season_start NULLS FIRST, b.id`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rule models.BookingRule
+		var noArrival, noDeparture string
+
+		err := rows.Scan(
+			&rule.ID,
+			&rule.Name,
+			&rule.RoomID,
+			&rule.SeasonStart,
+			&rule.SeasonEnd,
+			&rule.MinNights,
+			&rule.MaxNights,
+			&rule.MinNoticeHours,
+			&rule.MaxHorizonDays,
+			&noArrival,
+			&noDeparture,
+			&rule.CreatedAt,
+			&rule.UpdatedAt,
+			&rule.Room.RoomName,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		rule.NoArrivalDays = parseWeekdays(noArrival)
+		rule.NoDepartureDays = parseWeekdays(noDeparture)
+		rule.Room.ID = rule.RoomID
+
+		rules = append(rules, rule)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// InsertBookingRule adds a booking rule
+func (m *postgresDBRepo) InsertBookingRule(rule models.BookingRule) (int, error) {
+	var newId int
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var roomId interface{}
+	if rule.RoomID > 0 {
+		roomId = rule.RoomID
+	}
+
+	stmt := `INSERT INTO booking_rules (name, room_id, season_start, season_end, min_nights, max_nights, min_notice_hours,
+			     max_horizon_days, no_arrival_days, no_departure_days, created_at, updated_at)
+			 values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		rule.Name,
+		roomId,
+		rule.SeasonStart,
+		rule.SeasonEnd,
+		rule.MinNights,
+		rule.MaxNights,
+		rule.MinNoticeHours,
+		rule.MaxHorizonDays,
+		formatWeekdays(rule.NoArrivalDays),
+		formatWeekdays(rule.NoDepartureDays),
+		time.Now(),
+		time.Now(),
+	).Scan(&newId)
+	if err != nil {
+		return 0, err
+	}
+
+	rule.ID = newId
+	if err := m.audit(ctx, tx, auditInsert, "booking_rule", newId, nil, rule); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return newId, nil
+}
+
+// DeleteBookingRule removes a booking rule
+func (m *postgresDBRepo) DeleteBookingRule(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM booking_rules WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	if err := m.audit(ctx, tx, auditDelete, "booking_rule", id, nil, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,328 @@
+package dbrepo
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"github.com/chelobotix/booking-go/internal/dates"
+	"github.com/chelobotix/booking-go/internal/models"
+	"time"
+)
+
+// waitlistColumns are the columns read by scanWaitlistEntry
+const waitlistColumns = `w.id, w.first_name, w.last_name, w.email, w.start_date, w.end_date, COALESCE(w.room_id, 0),
+				 w.adults, w.children, w.status, COALESCE(w.token, ''), COALESCE(w.hold_id, 0),
+				 COALESCE(w.offered_room_id, 0), w.offer_expires_at, w.locale, w.created_at, w.updated_at,
+				 COALESCE(rm.room_name, ''), COALESCE(orm.room_name, '')`
+
+// waitlistJoins are the joins needed by waitlistColumns
+const waitlistJoins = `LEFT JOIN rooms rm ON rm.id = w.room_id
+			  LEFT JOIN rooms orm ON orm.id = w.offered_room_id`
+
+// scanWaitlistEntry reads a row selected with waitlistColumns
+func scanWaitlistEntry(row scanner, e *models.WaitlistEntry) error {
+	var offerExpiresAt sql.NullTime
+
+	err := row.Scan(
+		&e.ID,
+		&e.FirstName,
+		&e.LastName,
+		&e.Email,
+		&e.StartDate,
+		&e.EndDate,
+		&e.RoomID,
+		&e.Adults,
+		&e.Children,
+		&e.Status,
+		&e.Token,
+		&e.HoldID,
+		&e.OfferedRoomID,
+		&offerExpiresAt,
+		&e.Locale,
+		&e.CreatedAt,
+		&e.UpdatedAt,
+		&e.Room.RoomName,
+		&e.OfferedRoom.RoomName,
+	)
+	if err != nil {
+		return err
+	}
+
+	e.OfferExpiresAt = offerExpiresAt.Time
+	e.Room.ID = e.RoomID
+	e.OfferedRoom.ID = e.OfferedRoomID
+
+	return nil
+}
+
+// newToken returns a random token for links sent by email
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// InsertWaitlistEntry puts a guest on the waitlist
+func (m *postgresDBRepo) InsertWaitlistEntry(e models.WaitlistEntry) (int, error) {
+	var newId int
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var roomId interface{}
+	if e.RoomID > 0 {
+		roomId = e.RoomID
+	}
+
+	stmt := `INSERT INTO waitlist_entries (first_name, last_name, email, start_date, end_date, room_id, adults, children, status, locale, created_at, updated_at)
+			 values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		e.FirstName,
+		e.LastName,
+		e.Email,
+		e.StartDate,
+		e.EndDate,
+		roomId,
+		e.Adults,
+		e.Children,
+		models.WaitlistWaiting,
+		e.Locale,
+		time.Now(),
+		time.Now(),
+	).Scan(&newId)
+	if err != nil {
+		return 0, err
+	}
+
+	e.ID = newId
+	e.Status = models.WaitlistWaiting
+	if err := m.audit(ctx, tx, auditInsert, "waitlist_entry", newId, nil, e); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return newId, nil
+}
+
+// AllWaitlistEntries returns the whole waitlist, oldest first
+func (m *postgresDBRepo) AllWaitlistEntries() ([]models.WaitlistEntry, error) {
+	return m.listWaitlistEntries(`WHERE true`)
+}
+
+// WaitingWaitlistEntries returns the entries still waiting for dates after today, in the order they joined
+func (m *postgresDBRepo) WaitingWaitlistEntries(today dates.Date) ([]models.WaitlistEntry, error) {
+	return m.listWaitlistEntries(`WHERE w.status = $1 and w.start_date > $2`, models.WaitlistWaiting, today)
+}
+
+// listWaitlistEntries runs a waitlist select with the given WHERE clause
+func (m *postgresDBRepo) listWaitlistEntries(where string, args ...interface{}) ([]models.WaitlistEntry, error) {
+	var entries []models.WaitlistEntry
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + waitlistColumns + `
+			  FROM waitlist_entries w
+			  ` + waitlistJoins + `
+			  ` + where + `
+			  ORDER BY w.created_at, w.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.WaitlistEntry
+		if err := scanWaitlistEntry(rows, &e); err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// OfferWaitlistEntry holds roomId for a waiting entry until expiresAt and gives the entry a booking
+// token. Returns ErrNotAvailable when the room is taken and sql.ErrNoRows when the entry is no longer waiting
+func (m *postgresDBRepo) OfferWaitlistEntry(id, roomId int, expiresAt time.Time) (models.WaitlistEntry, error) {
+	var e models.WaitlistEntry
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return e, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + waitlistColumns + `
+			  FROM waitlist_entries w
+			  ` + waitlistJoins + `
+			  WHERE w.id = $1 and w.status = $2
+			  FOR UPDATE OF w`
+
+	err = scanWaitlistEntry(tx.QueryRowContext(ctx, query, id, models.WaitlistWaiting), &e)
+	if err != nil {
+		return e, err
+	}
+	before := e
+
+	holdId, err := insertHold(ctx, tx, roomId, e.StartDate, e.EndDate, expiresAt)
+	if err != nil {
+		return e, err
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return e, err
+	}
+
+	e.Status = models.WaitlistOffered
+	e.Token = token
+	e.HoldID = holdId
+	e.OfferedRoomID = roomId
+	e.OfferExpiresAt = expiresAt
+
+	_, err = tx.ExecContext(ctx, `UPDATE waitlist_entries
+		SET status = $1, token = $2, hold_id = $3, offered_room_id = $4, offer_expires_at = $5, updated_at = $6
+		WHERE id = $7`,
+		e.Status,
+		e.Token,
+		e.HoldID,
+		e.OfferedRoomID,
+		e.OfferExpiresAt,
+		time.Now(),
+		e.ID,
+	)
+	if err != nil {
+		return e, err
+	}
+
+	if err := m.audit(ctx, tx, auditUpdate, "waitlist_entry", e.ID, before, e); err != nil {
+		return e, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return e, err
+	}
+
+	return e, nil
+}
+
+// GetWaitlistOffer returns the entry for a booking token while its offer and hold are still live,
+// otherwise sql.ErrNoRows
+func (m *postgresDBRepo) GetWaitlistOffer(token string) (models.WaitlistEntry, error) {
+	var e models.WaitlistEntry
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + waitlistColumns + `
+			  FROM waitlist_entries w
+			  ` + waitlistJoins + `
+			  JOIN room_restrictions h ON h.id = w.hold_id
+			  WHERE w.token = $1 and w.status = $2 and w.offer_expires_at > now()
+			    and h.restriction_id = $3 and h.expires_at > now()`
+
+	err := scanWaitlistEntry(m.DB.QueryRowContext(ctx, query, token, models.WaitlistOffered, models.RestrictionHold), &e)
+
+	return e, err
+}
+
+// ExpireWaitlistEntries closes offers that ran out and entries whose dates have started,
+// returning how many were expired
+func (m *postgresDBRepo) ExpireWaitlistEntries(today dates.Date) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `UPDATE waitlist_entries w
+		SET status = $1, updated_at = $2
+		FROM waitlist_entries old
+		WHERE old.id = w.id
+		  and ((w.status = $3 and w.offer_expires_at <= now()) or (w.status = $4 and w.start_date <= $5))
+		returning w.id, old.status`,
+		models.WaitlistExpired,
+		time.Now(),
+		models.WaitlistOffered,
+		models.WaitlistWaiting,
+		today,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var expired []models.WaitlistEntry
+	for rows.Next() {
+		var e models.WaitlistEntry
+		if err := rows.Scan(&e.ID, &e.Status); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		expired = append(expired, e)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, before := range expired {
+		after := before
+		after.Status = models.WaitlistExpired
+		if err := m.audit(ctx, tx, auditUpdate, "waitlist_entry", before.ID, before, after); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(expired), nil
+}
+
+// bookWaitlistOffer marks the waitlist entry offered the hold, if any, as booked
+func (m *postgresDBRepo) bookWaitlistOffer(ctx context.Context, tx *sql.Tx, holdId int) error {
+	var id int
+
+	err := tx.QueryRowContext(ctx, `UPDATE waitlist_entries SET status = $1, updated_at = $2
+		WHERE hold_id = $3 and status = $4 returning id`,
+		models.WaitlistBooked,
+		time.Now(),
+		holdId,
+		models.WaitlistOffered,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return m.audit(ctx, tx, auditUpdate, "waitlist_entry", id,
+		models.WaitlistEntry{ID: id, Status: models.WaitlistOffered},
+		models.WaitlistEntry{ID: id, Status: models.WaitlistBooked})
+}
@@ -1,26 +1,115 @@
 package repository
 
 import (
+	"errors"
+	"github.com/chelobotix/booking-go/internal/dates"
 	"github.com/chelobotix/booking-go/internal/models"
 	"time"
 )
 
+// ErrNotAvailable is returned when a room is already taken for the requested dates
+var ErrNotAvailable = errors.New("room is not available for these dates")
+
+// ErrGuestRegistered is returned when registering an email that already has a guest account
+var ErrGuestRegistered = errors.New("guest is already registered")
+
+// ErrStayChanged is returned when an action finds the stay no longer as it expected, such as
+// already checked in or out or already cancelled, typically by a second submit or someone else
+var ErrStayChanged = errors.New("stay was changed meanwhile")
+
+// ErrRefunded is returned when restoring a cancelled reservation whose guest was refunded
+var ErrRefunded = errors.New("reservation was refunded on cancellation")
+
+// ErrGuestUnverified is returned when a guest logs in before confirming their email
+var ErrGuestUnverified = errors.New("guest email is not verified")
+
+// ErrPromoUnavailable is returned when a promo code was deactivated or used up before the booking went through
+var ErrPromoUnavailable = errors.New("promo code is no longer available")
+
 type DatabaseRepo interface {
+	WithActor(actor models.Actor) DatabaseRepo
 	AllUsers() bool
 	InsertReservation(r models.Reservation) (int, error)
 	InsertRoomRestriction(r models.RoomRestriction) error
-	SearchAvailabilityByDateByRoomId(startDate, endDate time.Time, roomId int) (bool, error)
-	SearchAvailabilityForAllRooms(startDate, endDate time.Time) ([]models.Room, error)
+	SearchAvailabilityByDateByRoomId(startDate, endDate dates.Date, roomId int) (bool, error)
+	SearchAvailabilityForAllRooms(startDate, endDate dates.Date, guests int) ([]models.Room, error)
+	SearchAvailableWindows(from, to, preferred dates.Date, nights, guests int) ([]models.AvailableWindow, error)
 	GetRoomById(id int) (models.Room, error)
-	GetRestrictionsForRoomByDate(roomId int, startDate, endDate time.Time) ([]models.RoomRestriction, error)
+	GetRestrictionsForRoomByDate(roomId int, startDate, endDate dates.Date) ([]models.RoomRestriction, error)
 	GetAllRooms() ([]models.Room, error)
+	UpdateRoomTurnover(room models.Room) error
+	UpdateRoomStatus(id int, status, note string) error
+	HousekeepingTasks(day dates.Date) ([]models.HousekeepingTask, error)
+	ArrivalsOn(day dates.Date) ([]models.Reservation, error)
+	DeparturesOn(day dates.Date) ([]models.Reservation, error)
+	InHouseReservations() ([]models.Reservation, error)
+	StaysInRoom(roomId int, day dates.Date) ([]models.Reservation, error)
+	CheckInReservation(res models.Reservation) error
+	CheckOutReservation(id int, settlement models.Payment) error
+	ExtendReservation(id int, endDate dates.Date) (models.Reservation, error)
 	GetUserById(id int) (models.User, error)
 	Authenticate(email, testPassword string) (int, string, error)
 
-	AllReservations() ([]models.Reservation, error)
-	AllNewReservations() ([]models.Reservation, error)
+	AllReservations(filter models.ReservationFilter) ([]models.Reservation, int, error)
+	AllNewReservations(filter models.ReservationFilter) ([]models.Reservation, int, error)
 	GetReservation(id int) (models.Reservation, error)
 	UpdateReservation(res models.Reservation) error
 	DeleteReservation(id int) error
+	RestoreReservation(id int) error
+	PurgeDeletedReservations(before time.Time) (int, error)
 	UpdateProcessedForReservation(id, processed int) error
+	StreamReservations(filter models.ReservationFilter, fn func(models.Reservation) error) error
+	ImportReservationsAndBlocks(reservations []models.Reservation, blocks []models.RoomRestriction) error
+
+	InsertHold(roomId int, startDate, endDate dates.Date, expiresAt time.Time) (int, error)
+	ReleaseHold(id int) error
+	DeleteExpiredHolds() (int, error)
+	ConfirmReservation(r models.Reservation) (int, error)
+
+	InsertBooking(reservations []models.Reservation) (models.Booking, error)
+	GetBookingReservations(bookingId int) ([]models.Reservation, error)
+
+	InsertWaitlistEntry(e models.WaitlistEntry) (int, error)
+	AllWaitlistEntries() ([]models.WaitlistEntry, error)
+	WaitingWaitlistEntries(today dates.Date) ([]models.WaitlistEntry, error)
+	OfferWaitlistEntry(id, roomId int, expiresAt time.Time) (models.WaitlistEntry, error)
+	GetWaitlistOffer(token string) (models.WaitlistEntry, error)
+	ExpireWaitlistEntries(today dates.Date) (int, error)
+
+	GetPromoCodes() ([]models.PromoCode, error)
+	GetPromoCodeByCode(code string) (models.PromoCode, error)
+	InsertPromoCode(promo models.PromoCode) (int, error)
+	SetPromoCodeActive(id int, active bool) error
+
+	GetCancellationPolicies() ([]models.CancellationPolicy, error)
+	GetCancellationPolicyForRoom(roomId int) (models.CancellationPolicy, error)
+	InsertCancellationPolicy(policy models.CancellationPolicy) (int, error)
+	SetCancellationPolicyActive(id int, active bool) error
+
+	AllCurrencies() ([]models.Currency, error)
+	GetCurrency(id int) (models.Currency, error)
+	InsertCurrency(c models.Currency) (int, error)
+	UpdateCurrency(c models.Currency) error
+	SetCurrencyActive(id int, active bool) error
+
+	InsertPayment(p models.Payment) (int, error)
+	GetPaymentsForReservation(reservationId int) ([]models.Payment, error)
+
+	IssueInvoice(reservationId int, property string, taxPercent int) (models.Invoice, error)
+
+	AllGuests(search string) ([]models.Guest, error)
+	GetGuest(id int) (models.Guest, error)
+	GetGuestByEmail(email string) (models.Guest, error)
+	UpdateGuest(g models.Guest) error
+	GetGuestReservations(guestId int) ([]models.Reservation, error)
+	RegisterGuest(g models.Guest, password string) (string, error)
+	RenewGuestVerification(id int) (models.Guest, string, error)
+	VerifyGuestEmail(token string) (int, error)
+	AuthenticateGuest(email, password string) (int, error)
+
+	GetBookingRules() ([]models.BookingRule, error)
+	InsertBookingRule(rule models.BookingRule) (int, error)
+	DeleteBookingRule(id int) error
+
+	GetAuditLogs(filter models.AuditFilter) ([]models.AuditLog, error)
 }
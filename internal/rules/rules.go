@@ -0,0 +1,123 @@
+package rules
+
+import (
+	"github.com/chelobotix/booking-go/internal/dates"
+	"github.com/chelobotix/booking-go/internal/i18n"
+	"github.com/chelobotix/booking-go/internal/models"
+	"time"
+)
+
+// Fields a violation can belong to
+const (
+	FieldStart = "start"
+	FieldEnd   = "end"
+)
+
+// Violation is a booking rule a stay breaks, Field is FieldStart or FieldEnd
+type Violation struct {
+	Field   string
+	Message i18n.Message
+}
+
+// Limits are the combined limits of every rule that applies to a stay
+type Limits struct {
+	MinNights       int
+	MaxNights       int
+	MinNoticeHours  int
+	MaxHorizonDays  int
+	NoArrivalDays   map[time.Weekday]bool
+	NoDepartureDays map[time.Weekday]bool
+}
+
+// Applies reports whether rule covers a stay in roomId arriving on start.
+// A roomId of 0 only matches rules for every room
+func Applies(rule models.BookingRule, roomId int, start dates.Date) bool {
+	if rule.RoomID != 0 && rule.RoomID != roomId {
+		return false
+	}
+	if !rule.SeasonStart.IsZero() && start.Before(rule.SeasonStart) {
+		return false
+	}
+	if !rule.SeasonEnd.IsZero() && start.After(rule.SeasonEnd) {
+		return false
+	}
+	return true
+}
+
+// Combine merges the rules that apply to the stay, keeping the strictest value of each limit
+func Combine(rules []models.BookingRule, roomId int, start dates.Date) Limits {
+	limits := Limits{
+		NoArrivalDays:   make(map[time.Weekday]bool),
+		NoDepartureDays: make(map[time.Weekday]bool),
+	}
+
+	for _, rule := range rules {
+		if !Applies(rule, roomId, start) {
+			continue
+		}
+
+		limits.MinNights = max(limits.MinNights, rule.MinNights)
+		limits.MinNoticeHours = max(limits.MinNoticeHours, rule.MinNoticeHours)
+		limits.MaxNights = minLimit(limits.MaxNights, rule.MaxNights)
+		limits.MaxHorizonDays = minLimit(limits.MaxHorizonDays, rule.MaxHorizonDays)
+
+		for _, day := range rule.NoArrivalDays {
+			limits.NoArrivalDays[day] = true
+		}
+		for _, day := range rule.NoDepartureDays {
+			limits.NoDepartureDays[day] = true
+		}
+	}
+
+	return limits
+}
+
+// minLimit returns the smaller of two limits where 0 means no limit
+func minLimit(a, b int) int {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// Check returns what is wrong with booking roomId from start to end at time now, which is in the
+// property's time zone. Besides the rules, a stay must be at least one night and may not arrive in the past
+func Check(rules []models.BookingRule, roomId int, start, end dates.Date, now time.Time) []Violation {
+	var violations []Violation
+
+	today := dates.Of(now)
+	nights := end.Sub(start)
+
+	if nights < 1 {
+		violations = append(violations, Violation{FieldEnd, i18n.M("Departure must be after arrival")})
+	}
+	if start.Before(today) {
+		violations = append(violations, Violation{FieldStart, i18n.M("Arrival can't be in the past")})
+	}
+	if len(violations) > 0 {
+		return violations
+	}
+
+	limits := Combine(rules, roomId, start)
+
+	if limits.MinNights > 0 && nights < limits.MinNights {
+		violations = append(violations, Violation{FieldEnd, i18n.M("Stays must be at least %d nights", limits.MinNights)})
+	}
+	if limits.MaxNights > 0 && nights > limits.MaxNights {
+		violations = append(violations, Violation{FieldEnd, i18n.M("Stays can be at most %d nights", limits.MaxNights)})
+	}
+	if limits.MinNoticeHours > 0 && start.In(now.Location()).Sub(now) < time.Duration(limits.MinNoticeHours)*time.Hour {
+		violations = append(violations, Violation{FieldStart, i18n.M("Bookings must be made at least %d hours before arrival", limits.MinNoticeHours)})
+	}
+	if limits.MaxHorizonDays > 0 && start.After(today.AddDays(limits.MaxHorizonDays)) {
+		violations = append(violations, Violation{FieldStart, i18n.M("Bookings can be made at most %d days in advance", limits.MaxHorizonDays)})
+	}
+	if limits.NoArrivalDays[start.Weekday()] {
+		violations = append(violations, Violation{FieldStart, i18n.M("Arrivals are not possible on %s", i18n.M(start.Weekday().String()))})
+	}
+	if limits.NoDepartureDays[end.Weekday()] {
+		violations = append(violations, Violation{FieldEnd, i18n.M("Departures are not possible on %s", i18n.M(end.Weekday().String()))})
+	}
+
+	return violations
+}
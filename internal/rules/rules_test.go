@@ -0,0 +1,175 @@
+package rules
+
+import (
+	"github.com/chelobotix/booking-go/internal/dates"
+	"github.com/chelobotix/booking-go/internal/i18n"
+	"github.com/chelobotix/booking-go/internal/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	lima := time.FixedZone("Lima", -5*60*60)
+
+	// Sunday, 10 March 2024, 10:00 at the property
+	now := time.Date(2024, 3, 10, 10, 0, 0, 0, lima)
+	day := func(d int) dates.Date { return dates.New(2024, 3, d) }
+
+	tests := []struct {
+		name       string
+		rules      []models.BookingRule
+		roomId     int
+		start, end dates.Date
+		want       []Violation
+	}{
+		{
+			name:  "no rules",
+			start: day(12),
+			end:   day(14),
+		},
+		{
+			name:  "arriving today",
+			start: day(10),
+			end:   day(11),
+		},
+		{
+			name:  "no nights",
+			start: day(12),
+			end:   day(12),
+			want:  []Violation{{FieldEnd, i18n.M("Departure must be after arrival")}},
+		},
+		{
+			name:  "in the past",
+			start: day(9),
+			end:   day(11),
+			want:  []Violation{{FieldStart, i18n.M("Arrival can't be in the past")}},
+		},
+		{
+			name:  "in the past and backwards skips the rules",
+			rules: []models.BookingRule{{MinNights: 3}},
+			start: day(9),
+			end:   day(8),
+			want: []Violation{
+				{FieldEnd, i18n.M("Departure must be after arrival")},
+				{FieldStart, i18n.M("Arrival can't be in the past")},
+			},
+		},
+		{
+			name:  "too short",
+			rules: []models.BookingRule{{MinNights: 3}},
+			start: day(12),
+			end:   day(14),
+			want:  []Violation{{FieldEnd, i18n.M("Stays must be at least %d nights", 3)}},
+		},
+		{
+			name:  "minimum met",
+			rules: []models.BookingRule{{MinNights: 3}},
+			start: day(12),
+			end:   day(15),
+		},
+		{
+			name:  "too long",
+			rules: []models.BookingRule{{MaxNights: 7}},
+			start: day(12),
+			end:   day(20),
+			want:  []Violation{{FieldEnd, i18n.M("Stays can be at most %d nights", 7)}},
+		},
+		{
+			name:  "strictest rule wins",
+			rules: []models.BookingRule{{MinNights: 2, MaxNights: 10}, {MinNights: 4, MaxNights: 5}},
+			start: day(12),
+			end:   day(18),
+			want:  []Violation{{FieldEnd, i18n.M("Stays can be at most %d nights", 5)}},
+		},
+		{
+			name:  "short notice",
+			rules: []models.BookingRule{{MinNoticeHours: 24}},
+			start: day(11),
+			end:   day(12),
+			want:  []Violation{{FieldStart, i18n.M("Bookings must be made at least %d hours before arrival", 24)}},
+		},
+		{
+			name:  "enough notice",
+			rules: []models.BookingRule{{MinNoticeHours: 14}},
+			start: day(11),
+			end:   day(12),
+		},
+		{
+			name:  "too far ahead",
+			rules: []models.BookingRule{{MaxHorizonDays: 30}},
+			start: dates.New(2024, 4, 10),
+			end:   dates.New(2024, 4, 12),
+			want:  []Violation{{FieldStart, i18n.M("Bookings can be made at most %d days in advance", 30)}},
+		},
+		{
+			name:  "last day of the horizon",
+			rules: []models.BookingRule{{MaxHorizonDays: 30}},
+			start: dates.New(2024, 4, 9),
+			end:   dates.New(2024, 4, 12),
+		},
+		{
+			name:  "closed weekdays",
+			rules: []models.BookingRule{{NoArrivalDays: []time.Weekday{time.Tuesday}, NoDepartureDays: []time.Weekday{time.Friday}}},
+			start: day(12),
+			end:   day(15),
+			want: []Violation{
+				{FieldStart, i18n.M("Arrivals are not possible on %s", i18n.M("Tuesday"))},
+				{FieldEnd, i18n.M("Departures are not possible on %s", i18n.M("Friday"))},
+			},
+		},
+		{
+			name:   "rule for another room",
+			rules:  []models.BookingRule{{RoomID: 2, MinNights: 3}},
+			roomId: 1,
+			start:  day(12),
+			end:    day(13),
+		},
+		{
+			name:   "rule for this room",
+			rules:  []models.BookingRule{{RoomID: 1, MinNights: 3}},
+			roomId: 1,
+			start:  day(12),
+			end:    day(13),
+			want:   []Violation{{FieldEnd, i18n.M("Stays must be at least %d nights", 3)}},
+		},
+		{
+			name:  "outside the season",
+			rules: []models.BookingRule{{SeasonStart: dates.New(2024, 6, 1), SeasonEnd: dates.New(2024, 8, 31), MinNights: 7}},
+			start: day(12),
+			end:   day(13),
+		},
+		{
+			name:  "inside the season",
+			rules: []models.BookingRule{{SeasonStart: dates.New(2024, 3, 1), SeasonEnd: dates.New(2024, 3, 31), MinNights: 7}},
+			start: day(12),
+			end:   day(13),
+			want:  []Violation{{FieldEnd, i18n.M("Stays must be at least %d nights", 7)}},
+		},
+	}
+
+	for _, tt := range tests {
+		got := Check(tt.rules, tt.roomId, tt.start, tt.end, now)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Check() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMinLimit(t *testing.T) {
+	tests := []struct {
+		a, b, want int
+	}{
+		{0, 0, 0},
+		{0, 5, 5},
+		{5, 0, 5},
+		{3, 5, 3},
+		{5, 3, 3},
+	}
+
+	for _, tt := range tests {
+		if got := minLimit(tt.a, tt.b); got != tt.want {
+			t.Errorf("minLimit(%d, %d) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
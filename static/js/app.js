@@ -105,4 +105,59 @@ function Prompt() {
         error: error,
         custom: custom,
     }
-}
\ No newline at end of file
+}
+// availabilityCalendar renders a month by month calendar of a room's free nights into elem,
+// using /room-availability/{id}
+function availabilityCalendar(elem, roomId) {
+    let month = new Date();
+    month.setDate(1);
+
+    const pad = function (n) {
+        return n < 10 ? "0" + n : "" + n;
+    }
+
+    const render = function (data) {
+        const title = month.toLocaleString("default", {month: "long", year: "numeric"});
+        let html = '<div class="d-flex justify-content-between align-items-center mb-2">'
+            + '<button type="button" class="btn btn-sm btn-outline-secondary" data-step="-1">&lt;&lt;</button>'
+            + '<strong>' + title + '</strong>'
+            + '<button type="button" class="btn btn-sm btn-outline-secondary" data-step="1">&gt;&gt;</button>'
+            + '</div>'
+            + '<table class="table table-sm table-bordered text-center availability-calendar"><thead><tr>'
+            + '<th>Mon</th><th>Tue</th><th>Wed</th><th>Thu</th><th>Fri</th><th>Sat</th><th>Sun</th>'
+            + '</tr></thead><tbody><tr>';
+
+        // Monday first
+        const offset = (month.getDay() + 6) % 7;
+        for (let i = 0; i < offset; i++) {
+            html += '<td></td>';
+        }
+
+        data.days.forEach(function (day, i) {
+            if (i > 0 && (offset + i) % 7 === 0) {
+                html += '</tr><tr>';
+            }
+            html += '<td class="' + (day.available ? 'available' : 'unavailable') + '" title="' + day.date + '">'
+                + parseInt(day.date.substring(8), 10) + '</td>';
+        });
+
+        html += '</tr></tbody></table>';
+        elem.innerHTML = html;
+
+        elem.querySelectorAll("button[data-step]").forEach(function (button) {
+            button.addEventListener("click", function () {
+                month.setMonth(month.getMonth() + parseInt(button.dataset.step, 10));
+                load();
+            });
+        });
+    }
+
+    const load = function () {
+        const from = month.getFullYear() + "-" + pad(month.getMonth() + 1);
+        fetch("/room-availability/" + roomId + "?from=" + from)
+            .then(response => response.json())
+            .then(render);
+    }
+
+    load();
+}